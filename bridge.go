@@ -0,0 +1,236 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/prometheus/common/log"
+)
+
+type bridgeCollector struct {
+	bridge                  Bridge
+	bridgeInfo              *prometheus.GaugeVec
+	bridgeUpdateState       *prometheus.GaugeVec
+	bridgeUpdateLastInstall prometheus.Gauge
+	bridgeAPIUsers          prometheus.Gauge
+	bridgePortalSignedOn    prometheus.Gauge
+	bridgeInternetServices  *prometheus.GaugeVec
+	bridgeTimeOffset        prometheus.Gauge
+	bridgeScrapesFailed     prometheus.Counter
+}
+
+var bridgeInfoLabelNames = []string{
+	"name",
+	"bridge_id",
+	"model_id",
+	"serial",
+	"api_version",
+	"software_version",
+	"zigbee_channel",
+}
+
+// bridgeUpdateStates are the states of the bridge's software update process, one of which is always reported
+var bridgeUpdateStates = []string{
+	"noupdates",
+	"transferring",
+	"anyreadytoinstall",
+	"allreadytoinstall",
+	"installing",
+}
+
+// NewBridgeCollector Create a new Hue collector for the bridge's own information and configuration
+func NewBridgeCollector(namespace string, bridge Bridge, bridgeName string) prometheus.Collector {
+	c := bridgeCollector{
+		bridge: bridge,
+		bridgeInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "bridge",
+				Name:        "info",
+				Help:        "Bridge information (always 1)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			bridgeInfoLabelNames,
+		),
+		bridgeUpdateState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "bridge",
+				Name:        "software_update_state",
+				Help:        "State of the software update process for the bridge and its devices (1 for the current state, 0 for others)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			[]string{"state"},
+		),
+		bridgeUpdateLastInstall: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "bridge",
+				Name:        "software_update_last_install_timestamp_seconds",
+				Help:        "Time the bridge last installed a software update (Unix epoch)",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+		bridgeAPIUsers: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "bridge",
+				Name:        "api_users",
+				Help:        "Number of users on the bridge's API whitelist",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+		bridgePortalSignedOn: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "bridge",
+				Name:        "portal_signed_on",
+				Help:        "Bridge signed on to the Hue portal (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+		bridgeInternetServices: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "bridge",
+				Name:        "internet_service_connected",
+				Help:        "Bridge connected to each of its internet services (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			[]string{"service"},
+		),
+		bridgeTimeOffset: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "bridge",
+				Name:        "time_offset_seconds",
+				Help:        "Difference between the bridge's clock and the exporter's clock",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+		bridgeScrapesFailed: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "bridge",
+				Name:        "scrapes_failed",
+				Help:        "Count of scrapes of bridge configuration from the Hue bridge that have failed",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+	}
+
+	return c
+}
+
+func (c bridgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.bridgeInfo.Describe(ch)
+	c.bridgeUpdateState.Describe(ch)
+	c.bridgeUpdateLastInstall.Describe(ch)
+	c.bridgeAPIUsers.Describe(ch)
+	c.bridgePortalSignedOn.Describe(ch)
+	c.bridgeInternetServices.Describe(ch)
+	c.bridgeTimeOffset.Describe(ch)
+	c.bridgeScrapesFailed.Describe(ch)
+}
+
+// serialNumber returns the bridge's serial number, which is its Ethernet MAC address without separators. The
+// bridge ID is the same address with "fffe" in the middle, and is used when the bridge doesn't report its MAC.
+func serialNumber(config datastore.Config) string {
+	if len(config.BridgeID) == 16 {
+		return strings.ToLower(config.BridgeID[:6] + config.BridgeID[10:])
+	}
+	return strings.ToLower(strings.Replace(config.MAC, ":", "", -1))
+}
+
+// apiUserNames returns the name of each API user, by username. Scenes and rules record the username that
+// created them, which is also the user's key to the API, so only the name is exported.
+func apiUserNames(bridge Bridge) map[string]string {
+	names := make(map[string]string)
+	d, err := bridge.GetDatastore()
+	if err != nil {
+		log.Errorf("Failed to look up API users: %v", err)
+		return names
+	}
+	for username, user := range d.Config.Whitelist {
+		names[username] = user.Name
+	}
+	return names
+}
+
+func (c bridgeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.bridgeInfo.Reset()
+	c.bridgeUpdateState.Reset()
+	c.bridgeInternetServices.Reset()
+
+	d, err := c.bridge.GetDatastore()
+	if err != nil {
+		log.Errorf("Failed to update bridge configuration: %v", err)
+		c.bridgeScrapesFailed.Inc()
+		c.bridgeScrapesFailed.Collect(ch)
+		return
+	}
+	config := d.Config
+
+	c.bridgeInfo.With(prometheus.Labels{
+		"name":             config.Name,
+		"bridge_id":        config.BridgeID,
+		"model_id":         config.ModelID,
+		"serial":           serialNumber(config),
+		"api_version":      config.APIVersion,
+		"software_version": config.SWVersion,
+		"zigbee_channel":   strconv.Itoa(config.ZigbeeChannel),
+	}).Set(1)
+	c.bridgeInfo.Collect(ch)
+
+	if config.SWUpdate2 != nil {
+		setStateSet(c.bridgeUpdateState, prometheus.Labels{}, "state", bridgeUpdateStates, config.SWUpdate2.State)
+		c.bridgeUpdateState.Collect(ch)
+
+		lastInstall, err := datastore.ParseTime(config.SWUpdate2.Bridge.LastInstall)
+		if err != nil {
+			log.Errorf("Failed to parse bridge last install time: %v", err)
+		} else if !lastInstall.IsZero() {
+			c.bridgeUpdateLastInstall.Set(float64(lastInstall.Unix()))
+			c.bridgeUpdateLastInstall.Collect(ch)
+		}
+	}
+
+	if config.Whitelist != nil {
+		c.bridgeAPIUsers.Set(float64(len(config.Whitelist)))
+		c.bridgeAPIUsers.Collect(ch)
+	}
+
+	if config.PortalState != nil {
+		if config.PortalState.SignedOn {
+			c.bridgePortalSignedOn.Set(1)
+		} else {
+			c.bridgePortalSignedOn.Set(0)
+		}
+		c.bridgePortalSignedOn.Collect(ch)
+	}
+
+	for service, state := range config.InternetServices {
+		if state == "connected" {
+			c.bridgeInternetServices.WithLabelValues(service).Set(1)
+		} else {
+			c.bridgeInternetServices.WithLabelValues(service).Set(0)
+		}
+	}
+	c.bridgeInternetServices.Collect(ch)
+
+	if config.UTC != "" && !d.Fetched.IsZero() {
+		bridgeTime, err := datastore.ParseTime(config.UTC)
+		if err != nil {
+			log.Errorf("Failed to parse bridge time: %v", err)
+		} else {
+			// the bridge only reports whole seconds, so offsets of less than a second aren't meaningful
+			c.bridgeTimeOffset.Set(bridgeTime.Sub(d.Fetched.Truncate(time.Second)).Seconds())
+			c.bridgeTimeOffset.Collect(ch)
+		}
+	}
+
+	c.bridgeScrapesFailed.Collect(ch)
+}
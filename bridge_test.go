@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/mitchellrj/hue_exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestBridgeCollector(t *testing.T) {
+	fixture, err := ioutil.ReadFile("datastore/testdata/datastore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d datastore.Datastore
+	if err = json.Unmarshal(fixture, &d); err != nil {
+		t.Fatal(err)
+	}
+	d.Config.UTC = time.Now().UTC().Add(time.Minute).Format(datastore.TimeFormat)
+	bridge := test.NewStubBridge().WithConfig(d.Config)
+
+	collector := NewBridgeCollector("test_hue", bridge, "test").(bridgeCollector)
+	metrics := make(chan prometheus.Metric, 20)
+	collector.Collect(metrics)
+	close(metrics)
+
+	info := gaugeValue(t, collector.bridgeInfo.With(prometheus.Labels{
+		"name":             "Philips hue",
+		"bridge_id":        "001788FFFE23BFC2",
+		"model_id":         "BSB002",
+		"serial":           "00178823bfc2",
+		"api_version":      "1.28.0",
+		"software_version": "1928083000",
+		"zigbee_channel":   "15",
+	}))
+	if info != 1 {
+		t.Errorf("Expected bridge info of 1, got %v", info)
+	}
+	for _, state := range bridgeUpdateStates {
+		expected := 0.0
+		if state == "anyreadytoinstall" {
+			expected = 1
+		}
+		if actual := gaugeValue(t, collector.bridgeUpdateState.WithLabelValues(state)); actual != expected {
+			t.Errorf("Expected %v for update state %v, got %v", expected, state, actual)
+		}
+	}
+	if actual := gaugeValue(t, collector.bridgeUpdateLastInstall); actual != 1536548700 {
+		t.Errorf("Expected last install at 1536548700, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.bridgeAPIUsers); actual != 2 {
+		t.Errorf("Expected 2 API users, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.bridgeInternetServices.WithLabelValues("swupdate")); actual != 0 {
+		t.Errorf("Expected swupdate service to be disconnected, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.bridgeTimeOffset); actual < 59 || actual > 61 {
+		t.Errorf("Expected a time offset of about 60 seconds, got %v", actual)
+	}
+}
+
+func TestBridgeCollectorFailure(t *testing.T) {
+	bridge := test.NewStubBridge().WithFailure(test.GetDatastoreFailure)
+
+	collector := NewBridgeCollector("test_hue", bridge, "test").(bridgeCollector)
+	metrics := make(chan prometheus.Metric, 20)
+	collector.Collect(metrics)
+	close(metrics)
+
+	if len(metrics) != 1 {
+		t.Errorf("Expected only the failure count to be collected, got %v metrics", len(metrics))
+	}
+	if actual := counterValue(t, collector.bridgeScrapesFailed); actual != 1 {
+		t.Errorf("Expected 1 failed scrape, got %v", actual)
+	}
+}
+
+func gaugeValue(t *testing.T, gauge prometheus.Gauge) float64 {
+	var metric dto.Metric
+	if err := gauge.Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetGauge().GetValue()
+}
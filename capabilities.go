@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/prometheus/common/log"
+)
+
+type capabilityCollector struct {
+	bridge                  Bridge
+	capabilityAvailable     *prometheus.GaugeVec
+	capabilityTotal         *prometheus.GaugeVec
+	capabilityScrapesFailed prometheus.Counter
+}
+
+var variableCapabilityLabelNames = []string{
+	"resource",
+}
+
+// NewCapabilityCollector Create a new Hue collector for the capacity of the bridge to store resources
+func NewCapabilityCollector(namespace string, bridge Bridge, bridgeName string) prometheus.Collector {
+	c := capabilityCollector{
+		bridge: bridge,
+		capabilityAvailable: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "capability",
+				Name:        "available",
+				Help:        "Number of resources of the kind that the bridge has room for",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableCapabilityLabelNames,
+		),
+		capabilityTotal: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "capability",
+				Name:        "total",
+				Help:        "Number of resources of the kind that the bridge can store",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableCapabilityLabelNames,
+		),
+		capabilityScrapesFailed: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "capability",
+				Name:        "scrapes_failed",
+				Help:        "Count of scrapes of capability data from the Hue bridge that have failed",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+	}
+
+	return c
+}
+
+func (c capabilityCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.capabilityAvailable.Describe(ch)
+	c.capabilityTotal.Describe(ch)
+	c.capabilityScrapesFailed.Describe(ch)
+}
+
+func (c capabilityCollector) Collect(ch chan<- prometheus.Metric) {
+	c.capabilityAvailable.Reset()
+	c.capabilityTotal.Reset()
+
+	capabilities, err := c.bridge.GetCapabilities()
+	if err != nil {
+		log.Errorf("Failed to update capabilities: %v", err)
+		c.capabilityScrapesFailed.Inc()
+	}
+
+	for resource, capacity := range capabilities {
+		c.capabilityAvailable.WithLabelValues(resource).Set(float64(capacity.Available))
+		c.capabilityTotal.WithLabelValues(resource).Set(float64(capacity.Total))
+	}
+
+	c.capabilityAvailable.Collect(ch)
+	c.capabilityTotal.Collect(ch)
+	c.capabilityScrapesFailed.Collect(ch)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/mitchellrj/hue_exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCapabilityCollector(t *testing.T) {
+	bridge := test.NewStubBridge().WithCapabilities(datastore.Capabilities{
+		"scenes":           {Available: 20, Total: 200},
+		"rules.conditions": {Available: 1498, Total: 1500},
+	})
+
+	collector := NewCapabilityCollector("test_hue", bridge, "test").(capabilityCollector)
+	metrics := make(chan prometheus.Metric, 10)
+	collector.Collect(metrics)
+	close(metrics)
+
+	if len(metrics) != 5 {
+		t.Errorf("Expected 5 metrics, got %v", len(metrics))
+	}
+	if actual := gaugeValue(t, collector.capabilityAvailable.WithLabelValues("scenes")); actual != 20 {
+		t.Errorf("Expected 20 scenes available, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.capabilityTotal.WithLabelValues("rules.conditions")); actual != 1500 {
+		t.Errorf("Expected 1500 rule conditions in total, got %v", actual)
+	}
+}
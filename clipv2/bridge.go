@@ -0,0 +1,241 @@
+// Package clipv2 is a client for the Hue CLIP v2 API, served by the bridge over HTTPS under /clip/v2. It
+// presents the bridge through the same types as the v1 API, from Collinux/gohue, so that the exporter's
+// collectors work the same with either.
+package clipv2
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+)
+
+// Bridge is a Hue bridge accessed through the CLIP v2 API
+type Bridge struct {
+	Address string
+	Key     string
+	client  *http.Client
+	// streamClient has no timeout, for the event stream
+	streamClient *http.Client
+}
+
+// NewBridge creates a bridge for the given address. The bridge's certificate is issued for its bridge ID, by
+// the Signify private CA, rather than for its address. If caFile is set, the certificate must be issued by
+// one of the CAs in it, otherwise it isn't verified at all.
+func NewBridge(address string, caFile string) (*Bridge, error) {
+	tlsConfig, err := newTLSConfig(caFile)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	return &Bridge{
+		Address: address,
+		client: &http.Client{
+			Timeout:   time.Second * 5,
+			Transport: transport,
+		},
+		streamClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+func newTLSConfig(caFile string) (*tls.Config, error) {
+	if caFile == "" {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %v", caFile)
+	}
+	return &tls.Config{
+		// The certificate names the bridge ID rather than its address, so only the chain is verified
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, len(rawCerts))
+			for i, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs[i] = cert
+			}
+			if len(certs) == 0 {
+				return errors.New("bridge presented no certificate")
+			}
+			intermediates := x509.NewCertPool()
+			for _, cert := range certs[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+			return err
+		},
+	}, nil
+}
+
+// apiResponse is the envelope of every CLIP v2 API response
+type apiResponse struct {
+	Errors []struct {
+		Description string `json:"description"`
+	} `json:"errors"`
+	Data []json.RawMessage `json:"data"`
+}
+
+// get fetches the resources at path, relative to /clip/v2
+func (b *Bridge) get(path string) ([]json.RawMessage, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://%s/clip/v2%s", b.Address, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("hue-application-key", b.Key)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to access bridge: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response apiResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode response from bridge (status %d): %v", resp.StatusCode, err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("error from bridge (status %d): %s", resp.StatusCode, response.Errors[0].Description)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status from bridge: %d", resp.StatusCode)
+	}
+	return response.Data, nil
+}
+
+// Login verifies that the application key has access to the bridge, and uses it for all further requests
+func (b *Bridge) Login(key string) error {
+	b.Key = key
+	_, err := b.get("/resource/bridge")
+	if err != nil {
+		b.Key = ""
+		return err
+	}
+	return nil
+}
+
+// GetResources retrieves every resource on the bridge with a single request
+func (b *Bridge) GetResources() (*Resources, error) {
+	data, err := b.get("/resource")
+	if err != nil {
+		return nil, err
+	}
+	var resources Resources
+	for _, raw := range data {
+		err = resources.add(raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &resources, nil
+}
+
+// GetDatastore retrieves every resource on the bridge and converts them to their v1 API equivalents
+func (b *Bridge) GetDatastore() (*datastore.Datastore, error) {
+	fetched := time.Now()
+	resources, err := b.GetResources()
+	if err != nil {
+		return nil, err
+	}
+	d := resources.Datastore()
+	d.Fetched = fetched
+	return d, nil
+}
+
+// GetCapabilities retrieves the capacity of the bridge for each kind of resource. The CLIP v2 API has no
+// equivalent, so this uses the v1 API, which the bridge also serves over HTTPS.
+func (b *Bridge) GetCapabilities() (datastore.Capabilities, error) {
+	resp, err := b.client.Get(fmt.Sprintf("https://%s/api/%s/capabilities", b.Address, b.Key))
+	if err != nil {
+		return nil, fmt.Errorf("unable to access bridge: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var c datastore.Capabilities
+	err = datastore.Decode(body, &c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetAllLights retrieves the state of all lights
+func (b *Bridge) GetAllLights() ([]hue.Light, error) {
+	d, err := b.GetDatastore()
+	if err != nil {
+		return []hue.Light{}, err
+	}
+	return d.Lights, nil
+}
+
+// GetLights retrieves the state of all lights, in a datastore with nothing else but their IDs, as lights that
+// have no v1 ID can only be identified with those from the same datastore
+func (b *Bridge) GetLights() (*datastore.Datastore, error) {
+	d, err := b.GetDatastore()
+	if err != nil {
+		return nil, err
+	}
+	return &datastore.Datastore{
+		Lights:  d.Lights,
+		IDs:     datastore.IDs{Lights: d.IDs.Lights},
+		Fetched: d.Fetched,
+	}, nil
+}
+
+// GetAllGroups retrieves the state of all rooms and zones
+func (b *Bridge) GetAllGroups() ([]hue.Group, error) {
+	d, err := b.GetDatastore()
+	if err != nil {
+		return []hue.Group{}, err
+	}
+	return d.Groups, nil
+}
+
+// GetAllSensors retrieves the state of all sensors
+func (b *Bridge) GetAllSensors() ([]hue.Sensor, error) {
+	d, err := b.GetDatastore()
+	if err != nil {
+		return []hue.Sensor{}, err
+	}
+	return d.Sensors, nil
+}
+
+// GetAllScenes retrieves all scenes
+func (b *Bridge) GetAllScenes() ([]hue.Scene, error) {
+	d, err := b.GetDatastore()
+	if err != nil {
+		return []hue.Scene{}, err
+	}
+	return d.Scenes, nil
+}
+
+// GetAllSchedules retrieves all schedules. The CLIP v2 API has no schedules, so there are never any.
+func (b *Bridge) GetAllSchedules() ([]datastore.Schedule, error) {
+	return []datastore.Schedule{}, nil
+}
+
+// GetAllRules retrieves all rules. The CLIP v2 API has no rules, so there are never any.
+func (b *Bridge) GetAllRules() ([]datastore.Rule, error) {
+	return []datastore.Rule{}, nil
+}
@@ -0,0 +1,148 @@
+package clipv2
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/test"
+)
+
+func newTestBridge(t *testing.T) (*Bridge, func()) {
+	resources, err := ioutil.ReadFile("testdata/resources.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := test.NewCLIPv2Server("key", resources)
+	bridge, err := NewBridge(strings.TrimPrefix(server.URL, "https://"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bridge, server.Close
+}
+
+func TestLogin(t *testing.T) {
+	bridge, close := newTestBridge(t)
+	defer close()
+
+	if err := bridge.Login("wrong"); err == nil || !strings.Contains(err.Error(), "unauthorized user") {
+		t.Errorf("Expected an unauthorized user error, got %v", err)
+	}
+	if err := bridge.Login("key"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestGetDatastore(t *testing.T) {
+	bridge, close := newTestBridge(t)
+	defer close()
+	if err := bridge.Login("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := bridge.GetDatastore()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if d.Config.BridgeID != "001788fffe23bfc2" || d.Config.ModelID != "BSB002" {
+		t.Errorf("Unexpected config: %+v", d.Config)
+	}
+
+	lights := make(map[string]hue.Light)
+	for _, light := range d.Lights {
+		lights[light.Name] = light
+	}
+	lamp := lights["Hallway"]
+	if lamp.Index != 1 || lamp.Type != "Extended color light" || lamp.UniqueID != "00:17:88:01:03:aa:bb:cc-0b" || lamp.ModelID != "LCT015" {
+		t.Errorf("Unexpected light: %+v", lamp)
+	}
+	if !lamp.State.On || !lamp.State.Reachable || lamp.State.Bri != 127 || lamp.State.CT != 366 || lamp.State.ColorMode != "ct" {
+		t.Errorf("Unexpected light state: %+v", lamp.State)
+	}
+	plug := lights["Fan"]
+	if plug.Type != "On/Off plug-in unit" || plug.State.On || plug.State.Reachable {
+		t.Errorf("Unexpected plug: %+v", plug)
+	}
+
+	if len(d.Groups) != 1 {
+		t.Fatalf("Expected 1 group, got %d", len(d.Groups))
+	}
+	group := d.Groups[0]
+	if group.Index != 1 || group.Type != "Room" || group.Class != "Living room" || len(group.Lights) != 2 {
+		t.Errorf("Unexpected group: %+v", group)
+	}
+	if !group.State.AnyOn || group.State.AllOn || group.Action.Bri != 254 {
+		t.Errorf("Unexpected group state: %+v %+v", group.State, group.Action)
+	}
+
+	sensors := make(map[string]hue.Sensor)
+	for _, sensor := range d.Sensors {
+		sensors[sensor.Type] = sensor
+	}
+	if len(d.Sensors) != 5 {
+		t.Errorf("Expected 5 sensors, got %d", len(d.Sensors))
+	}
+	presence := sensors["ZLLPresence"]
+	if !presence.State.Presence || presence.Index != 5 || presence.Config.Battery != 87 || presence.UniqueID != "00:17:88:01:02:00:af:28-02-0406" {
+		t.Errorf("Unexpected presence sensor: %+v", presence)
+	}
+	if temperature := sensors["ZLLTemperature"]; temperature.State.Temperature != 2137 {
+		t.Errorf("Unexpected temperature sensor: %+v", temperature)
+	}
+	if lightLevel := sensors["ZLLLightLevel"]; lightLevel.State.LightLevel != 15000 {
+		t.Errorf("Unexpected light level sensor: %+v", lightLevel)
+	}
+	dimmer := sensors["ZLLSwitch"]
+	if dimmer.State.ButtonEvent != 4003 || dimmer.Config.Battery != 12 || dimmer.State.LastUpdated.Hour() != 9 {
+		t.Errorf("Unexpected switch: %+v", dimmer)
+	}
+	if contact := sensors["ZLLContact"]; contact.State.Status != 1 || contact.Name != "Front door" {
+		t.Errorf("Unexpected contact sensor: %+v", contact)
+	}
+	// The contact sensor has no v1 ID, so it's identified by its v2 ID
+	if id := d.IDs.Sensor(sensors["ZLLContact"]); id != "c-door" {
+		t.Errorf("Expected the contact sensor's v2 ID, got %q", id)
+	}
+	if id := d.IDs.Sensor(presence); id != "5" {
+		t.Errorf("Expected the presence sensor's v1 ID, got %q", id)
+	}
+
+	if len(d.Scenes) != 1 || d.Scenes[0].ID != "abc" || len(d.Scenes[0].Lights) != 1 || d.Scenes[0].Lights[0] != "1" {
+		t.Errorf("Unexpected scenes: %+v", d.Scenes)
+	}
+}
+
+func TestDatastoreIDs(t *testing.T) {
+	zone := func(id string, idv1 string) Group {
+		return Group{resource: resource{ID: id, IDv1: idv1, Type: "zone"}, Metadata: metadata{Name: "Downstairs"}}
+	}
+	r := Resources{Zones: []Group{zone("z-1", ""), zone("z-2", ""), zone("z-3", "/groups/3")}}
+	d := r.Datastore()
+
+	ids := []string{}
+	for _, group := range d.Groups {
+		ids = append(ids, d.IDs.Group(group))
+	}
+	// Zones with the same name and no v1 ID are still told apart
+	if len(ids) != 3 || ids[0] != "z-1" || ids[1] != "z-2" || ids[2] != "3" {
+		t.Errorf("Unexpected group IDs: %v", ids)
+	}
+	// The IDs are only known to the datastore they were converted in
+	if id := (&Resources{}).Datastore().IDs.Group(d.Groups[0]); id == "z-1" {
+		t.Error("Expected the v2 ID to only be known to its own datastore")
+	}
+}
+
+func TestXYToHueSat(t *testing.T) {
+	// the red corner of gamut C should be a saturated red
+	h, s := xyToHueSat(0.6915, 0.3083)
+	if (h > 2000 && h < 63535) || s < 240 {
+		t.Errorf("Expected saturated red, got hue %d, saturation %d", h, s)
+	}
+	// D65 white point should be unsaturated
+	if _, s := xyToHueSat(0.3127, 0.3290); s > 30 {
+		t.Errorf("Expected white to be unsaturated, got saturation %d", s)
+	}
+}
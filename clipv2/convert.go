@@ -0,0 +1,394 @@
+package clipv2
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+)
+
+// buttonEventCodes maps v2 button events to the last digit of v1 `buttonevent` codes, which are the
+// button's control ID * 1000 plus this code
+var buttonEventCodes = map[string]uint16{
+	"initial_press": 0,
+	"repeat":        1,
+	"long_press":    1,
+	"short_release": 2,
+	"long_release":  3,
+}
+
+// tapButtonEventCodes maps the control IDs of the Hue tap switch's buttons to their v1 `buttonevent` codes
+var tapButtonEventCodes = map[int]uint16{
+	1: 34,
+	2: 16,
+	3: 17,
+	4: 18,
+}
+
+// converter converts v2 resources into their v1 equivalents
+type converter struct {
+	devices       map[string]Device
+	lights        map[string]Light
+	groupedLights map[string]GroupedLight
+	// zigbee and power are keyed by the ID of the device that owns them
+	zigbee map[string]ZigbeeConnectivity
+	power  map[string]DevicePower
+	// ids are the v2 IDs of the resources converted without a v1 ID
+	ids datastore.IDs
+}
+
+func newConverter(r *Resources) *converter {
+	c := converter{
+		devices:       make(map[string]Device),
+		lights:        make(map[string]Light),
+		groupedLights: make(map[string]GroupedLight),
+		zigbee:        make(map[string]ZigbeeConnectivity),
+		power:         make(map[string]DevicePower),
+		ids:           datastore.NewIDs(),
+	}
+	for _, device := range r.Devices {
+		c.devices[device.ID] = device
+	}
+	for _, light := range r.Lights {
+		c.lights[light.ID] = light
+	}
+	for _, groupedLight := range r.GroupedLights {
+		c.groupedLights[groupedLight.ID] = groupedLight
+	}
+	for _, zigbee := range r.ZigbeeConnectivity {
+		c.zigbee[zigbee.OwnerID()] = zigbee
+	}
+	for _, power := range r.DevicePower {
+		c.power[power.OwnerID()] = power
+	}
+	return &c
+}
+
+// Datastore converts the resources into the v1 API datastore. The v2 API has no equivalent of v1 schedules
+// and rules, so there are none.
+func (r *Resources) Datastore() *datastore.Datastore {
+	c := newConverter(r)
+	d := datastore.Datastore{
+		Lights:    make([]hue.Light, 0, len(r.Lights)),
+		Groups:    make([]hue.Group, 0, len(r.Rooms)+len(r.Zones)),
+		Sensors:   []hue.Sensor{},
+		Scenes:    make([]hue.Scene, 0, len(r.Scenes)),
+		Schedules: []datastore.Schedule{},
+		Rules:     []datastore.Rule{},
+		IDs:       c.ids,
+	}
+
+	for _, bridge := range r.Bridges {
+		device := c.devices[bridge.OwnerID()]
+		d.Config = datastore.Config{
+			Name:      device.Metadata.Name,
+			BridgeID:  bridge.BridgeID,
+			ModelID:   device.ProductData.ModelID,
+			MAC:       c.zigbee[device.ID].MACAddress,
+			SWVersion: device.ProductData.SoftwareVersion,
+		}
+	}
+	for _, light := range r.Lights {
+		d.Lights = append(d.Lights, c.light(light))
+	}
+	for _, room := range r.Rooms {
+		d.Groups = append(d.Groups, c.group(room, "Room"))
+	}
+	for _, zone := range r.Zones {
+		d.Groups = append(d.Groups, c.group(zone, "Zone"))
+	}
+	for _, motion := range r.Motion {
+		sensor := c.sensor(motion.resource, "ZLLPresence", "-02-0406", motion.Enabled)
+		sensor.State.Presence = motion.Motion.Motion
+		if motion.Motion.MotionReport != nil {
+			sensor.State.LastUpdated = updateTime(motion.Motion.MotionReport.Changed)
+		}
+		d.Sensors = append(d.Sensors, sensor)
+	}
+	for _, temperature := range r.Temperature {
+		sensor := c.sensor(temperature.resource, "ZLLTemperature", "-02-0402", temperature.Enabled)
+		sensor.State.Temperature = int16(math.Round(temperature.Temperature.Temperature * 100))
+		if temperature.Temperature.TemperatureReport != nil {
+			sensor.State.LastUpdated = updateTime(temperature.Temperature.TemperatureReport.Changed)
+		}
+		d.Sensors = append(d.Sensors, sensor)
+	}
+	for _, lightLevel := range r.LightLevel {
+		sensor := c.sensor(lightLevel.resource, "ZLLLightLevel", "-02-0400", lightLevel.Enabled)
+		sensor.State.LightLevel = uint16(lightLevel.Light.LightLevel)
+		if lightLevel.Light.LightLevelReport != nil {
+			sensor.State.LastUpdated = updateTime(lightLevel.Light.LightLevelReport.Changed)
+		}
+		d.Sensors = append(d.Sensors, sensor)
+	}
+	for _, contact := range r.Contacts {
+		// there's no contact sensor in the v1 API, so it's presented like a generic status sensor
+		sensor := c.sensor(contact.resource, "ZLLContact", "-02-0500", contact.Enabled)
+		if contact.ContactReport != nil {
+			if contact.ContactReport.State == "no_contact" {
+				sensor.State.Status = 1
+			}
+			sensor.State.LastUpdated = updateTime(contact.ContactReport.Changed)
+		}
+		d.Sensors = append(d.Sensors, sensor)
+	}
+	d.Sensors = append(d.Sensors, c.switches(r.Buttons)...)
+	for _, scene := range r.Scenes {
+		d.Scenes = append(d.Scenes, c.scene(scene))
+	}
+	return &d
+}
+
+// index returns the v1 index of a resource, or if it has none, a negative index that its v2 ID is kept under
+// in ids
+func (c *converter) index(ids map[int]string, r resource) int {
+	if r.IDv1 != "" {
+		return r.index()
+	}
+	index := -len(ids) - 1
+	ids[index] = r.ID
+	return index
+}
+
+// uniqueID builds a v1 style unique ID for a service of a device from its Zigbee MAC address and suffix,
+// which identifies the endpoint and cluster of the service.
+func (c *converter) uniqueID(deviceID string, suffix string) string {
+	mac := c.zigbee[deviceID].MACAddress
+	if mac == "" {
+		return deviceID
+	}
+	return mac + suffix
+}
+
+func (c *converter) light(light Light) hue.Light {
+	device := c.devices[light.OwnerID()]
+	l := hue.Light{
+		Type:             lightType(light),
+		Name:             light.Metadata.Name,
+		ModelID:          device.ProductData.ModelID,
+		ManufacturerName: device.ProductData.ManufacturerName,
+		ProductName:      device.ProductData.ProductName,
+		UniqueID:         c.uniqueID(device.ID, "-0b"),
+		SWVersion:        device.ProductData.SoftwareVersion,
+		Index:            c.index(c.ids.Lights, light.resource),
+	}
+	l.State.On = light.On.On
+	l.State.Reachable = c.zigbee[device.ID].Status == "connected"
+	l.State.Alert = "none"
+	l.State.Effect = "none"
+	if light.Dimming != nil {
+		l.State.Bri = uint8(math.Round(light.Dimming.Brightness * 254 / 100))
+	}
+	if light.Color != nil {
+		l.State.XY = [2]float32{float32(light.Color.XY.X), float32(light.Color.XY.Y)}
+		l.State.Hue, l.State.Saturation = xyToHueSat(light.Color.XY.X, light.Color.XY.Y)
+		l.State.ColorMode = "xy"
+	}
+	if light.ColorTemperature != nil && light.ColorTemperature.Mirek != nil {
+		l.State.CT = *light.ColorTemperature.Mirek
+		if light.ColorTemperature.MirekValid {
+			l.State.ColorMode = "ct"
+		}
+	}
+	if light.Effects != nil && light.Effects.Status != "no_effect" {
+		l.State.Effect = light.Effects.Status
+	}
+	return l
+}
+
+// lightType returns the v1 type of a light from its capabilities
+func lightType(light Light) string {
+	switch {
+	case light.Color != nil && light.ColorTemperature != nil:
+		return "Extended color light"
+	case light.Color != nil:
+		return "Color light"
+	case light.ColorTemperature != nil:
+		return "Color temperature light"
+	case light.Dimming != nil:
+		return "Dimmable light"
+	default:
+		return "On/Off plug-in unit"
+	}
+}
+
+// xyToHueSat converts a colour in CIE xy space to v1 hue (0-65535) and saturation (0-254) values, using the
+// wide gamut conversion from the Hue developer documentation
+func xyToHueSat(x, y float64) (uint16, uint8) {
+	if y == 0 {
+		return 0, 0
+	}
+	X := x / y
+	Z := (1 - x - y) / y
+	r := math.Max(X*1.656492-0.354851-Z*0.255038, 0)
+	g := math.Max(-X*0.707196+1.655397+Z*0.036152, 0)
+	b := math.Max(X*0.051713-0.121364+Z*1.011530, 0)
+
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	if max == 0 || max == min {
+		return 0, 0
+	}
+	delta := max - min
+	var h float64
+	switch max {
+	case r:
+		h = math.Mod((g-b)/delta, 6)
+	case g:
+		h = (b-r)/delta + 2
+	default:
+		h = (r-g)/delta + 4
+	}
+	if h < 0 {
+		h += 6
+	}
+	return uint16(math.Round(h / 6 * 65535)), uint8(math.Round(delta / max * 254))
+}
+
+// group converts a room or zone to a v1 group, with its state and action taken from its grouped light
+func (c *converter) group(group Group, groupType string) hue.Group {
+	g := hue.Group{
+		Name:   group.Metadata.Name,
+		Type:   groupType,
+		Class:  groupClass(group.Metadata.Archetype),
+		Lights: []string{},
+		Index:  c.index(c.ids.Groups, group.resource),
+	}
+
+	members := []Light{}
+	for _, child := range group.Children {
+		switch child.RType {
+		case "light":
+			if light, ok := c.lights[child.RID]; ok {
+				members = append(members, light)
+			}
+		case "device":
+			for _, service := range c.devices[child.RID].Services {
+				if light, ok := c.lights[service.RID]; ok && service.RType == "light" {
+					members = append(members, light)
+				}
+			}
+		}
+	}
+	g.State.AllOn = len(members) > 0
+	for _, light := range members {
+		g.Lights = append(g.Lights, light.V1ID())
+		g.State.AnyOn = g.State.AnyOn || light.On.On
+		g.State.AllOn = g.State.AllOn && light.On.On
+	}
+
+	for _, service := range group.Services {
+		groupedLight, ok := c.groupedLights[service.RID]
+		if !ok {
+			continue
+		}
+		if groupedLight.On != nil {
+			g.Action.On = groupedLight.On.On
+		}
+		if groupedLight.Dimming != nil {
+			g.Action.Bri = int(math.Round(groupedLight.Dimming.Brightness * 254 / 100))
+		}
+	}
+	return g
+}
+
+// groupClass converts a v2 room archetype such as "living_room" to a v1 class such as "Living room"
+func groupClass(archetype string) string {
+	if archetype == "" {
+		return ""
+	}
+	class := strings.Replace(archetype, "_", " ", -1)
+	return strings.ToUpper(class[:1]) + class[1:]
+}
+
+// sensor creates a v1 sensor for a v2 sensor service, with the details of the device that owns it
+func (c *converter) sensor(r resource, sensorType string, suffix string, enabled bool) hue.Sensor {
+	device := c.devices[r.OwnerID()]
+	s := hue.Sensor{
+		Type:             sensorType,
+		Name:             device.Metadata.Name,
+		ModelID:          device.ProductData.ModelID,
+		ManufacturerName: device.ProductData.ManufacturerName,
+		ProductName:      device.ProductData.ProductName,
+		UniqueID:         c.uniqueID(device.ID, suffix),
+		SWVersion:        device.ProductData.SoftwareVersion,
+		Index:            c.index(c.ids.Sensors, r),
+	}
+	s.State.LastUpdated = updateTime(time.Time{})
+	s.Config.On = enabled
+	s.Config.Reachable = c.zigbee[device.ID].Status == "connected"
+	s.Config.Battery = uint8(c.power[device.ID].PowerState.BatteryLevel)
+	s.Capabilities.Certified = device.ProductData.Certified
+	return s
+}
+
+// switches converts the buttons of each device into a single v1 switch sensor per device, whose button event
+// is that of the most recently used button, as in the v1 API
+func (c *converter) switches(buttons []Button) []hue.Sensor {
+	latest := make(map[string]Button)
+	order := []string{}
+	for _, button := range buttons {
+		current, ok := latest[button.OwnerID()]
+		if !ok {
+			order = append(order, button.OwnerID())
+		}
+		if !ok || buttonUpdated(button).After(buttonUpdated(current)) {
+			latest[button.OwnerID()] = button
+		}
+	}
+
+	sensors := make([]hue.Sensor, 0, len(order))
+	for _, owner := range order {
+		button := latest[owner]
+		event := button.Button.LastEvent
+		if button.Button.ButtonReport != nil {
+			event = button.Button.ButtonReport.Event
+		}
+
+		var sensor hue.Sensor
+		if c.devices[owner].ProductData.ModelID == "ZGPSWITCH" {
+			sensor = c.sensor(button.resource, "ZGPSwitch", "-f2", true)
+			sensor.State.ButtonEvent = tapButtonEventCodes[button.Metadata.ControlID]
+		} else {
+			sensor = c.sensor(button.resource, "ZLLSwitch", "-02-fc00", true)
+			if code, ok := buttonEventCodes[event]; ok {
+				sensor.State.ButtonEvent = uint16(button.Metadata.ControlID)*1000 + code
+			}
+		}
+		sensor.State.LastUpdated = updateTime(buttonUpdated(button))
+		sensors = append(sensors, sensor)
+	}
+	return sensors
+}
+
+func buttonUpdated(button Button) time.Time {
+	if button.Button.ButtonReport == nil {
+		return time.Time{}
+	}
+	return button.Button.ButtonReport.Updated
+}
+
+func (c *converter) scene(scene Scene) hue.Scene {
+	s := hue.Scene{
+		ID:     scene.ID,
+		Name:   scene.Metadata.Name,
+		Lights: []string{},
+	}
+	if scene.IDv1 != "" {
+		s.ID = scene.IDv1[strings.LastIndex(scene.IDv1, "/")+1:]
+	}
+	for _, action := range scene.Actions {
+		if light, ok := c.lights[action.Target.RID]; ok {
+			s.Lights = append(s.Lights, light.V1ID())
+		}
+	}
+	return s
+}
+
+// updateTime converts a time to the type gohue uses for the time a sensor was last updated
+func updateTime(t time.Time) hue.UpdateTime {
+	t = t.UTC()
+	return hue.UpdateTime{Time: &t}
+}
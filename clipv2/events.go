@@ -0,0 +1,102 @@
+package clipv2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// Event is a message from the event stream, describing changes to one or more resources. Each item of Data
+// is a partial resource, with only the fields that have changed.
+type Event struct {
+	ID           string            `json:"id"`
+	CreationTime time.Time         `json:"creationtime"`
+	Type         string            `json:"type"`
+	Data         []json.RawMessage `json:"data"`
+}
+
+// StreamEvents connects to the bridge's event stream and calls handle with every event it receives, until
+// the stream ends, fails or ctx is cancelled.
+func (b *Bridge) StreamEvents(ctx context.Context, handle func(Event)) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://%s/eventstream/clip/v2", b.Address), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("hue-application-key", b.Key)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := b.streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to access bridge event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status from bridge event stream: %d", resp.StatusCode)
+	}
+
+	// Server-sent events are separated by blank lines. Each message from the bridge has a single data field,
+	// containing a JSON array of events.
+	var data bytes.Buffer
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			if data.Len() > 0 {
+				var events []Event
+				if err := json.Unmarshal(data.Bytes(), &events); err != nil {
+					return fmt.Errorf("unable to decode event stream message: %v", err)
+				}
+				for _, event := range events {
+					handle(event)
+				}
+				data.Reset()
+			}
+		case bytes.HasPrefix(line, []byte("data:")):
+			data.Write(bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" ")))
+		}
+		// other fields, such as the event ID, and comments used to keep the connection alive are ignored
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("bridge closed the event stream")
+}
+
+// SubscribeEvents streams events from the bridge until ctx is cancelled, reconnecting with exponential
+// backoff whenever the stream fails. onError is called with every failure.
+func (b *Bridge) SubscribeEvents(ctx context.Context, handle func(Event), onError func(error)) {
+	delay := minReconnectDelay
+	for {
+		connected := time.Now()
+		err := b.StreamEvents(ctx, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		onError(err)
+
+		// a stream that stayed up for a while isn't part of a run of failures
+		if time.Since(connected) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
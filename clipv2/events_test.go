@@ -0,0 +1,99 @@
+package clipv2
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellrj/hue_exporter/test"
+)
+
+func TestStreamEvents(t *testing.T) {
+	resources, err := ioutil.ReadFile("testdata/resources.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recording, err := ioutil.ReadFile("testdata/eventstream.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := test.NewCLIPv2ServerWithEvents("key", resources, recording)
+	defer server.Close()
+	bridge, err := NewBridge(strings.TrimPrefix(server.URL, "https://"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge.Key = "key"
+
+	events := []Event{}
+	err = bridge.StreamEvents(context.Background(), func(event Event) {
+		events = append(events, event)
+	})
+	if err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("Expected the stream to be closed, got %v", err)
+	}
+	if len(events) != 7 {
+		t.Fatalf("Expected 7 events, got %d", len(events))
+	}
+	if events[0].Type != "update" || len(events[0].Data) != 1 || events[0].CreationTime.Minute() != 0 {
+		t.Errorf("Unexpected event: %+v", events[0])
+	}
+}
+
+func TestSubscribeEventsReconnects(t *testing.T) {
+	resources, err := ioutil.ReadFile("testdata/resources.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recording, err := ioutil.ReadFile("testdata/eventstream.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := test.NewCLIPv2ServerWithEvents("key", resources, recording)
+	defer server.Close()
+	bridge, err := NewBridge(strings.TrimPrefix(server.URL, "https://"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge.Key = "key"
+
+	defer func(min, max time.Duration) {
+		minReconnectDelay, maxReconnectDelay = min, max
+	}(minReconnectDelay, maxReconnectDelay)
+	minReconnectDelay, maxReconnectDelay = 20*time.Millisecond, 40*time.Millisecond
+
+	// The recording closes the stream after replaying it, so every connection fails once it has been read
+	ctx, cancel := context.WithCancel(context.Background())
+	events := 0
+	failures := []time.Time{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bridge.SubscribeEvents(ctx, func(event Event) {
+			events++
+		}, func(err error) {
+			failures = append(failures, time.Now())
+			if len(failures) == 4 {
+				cancel()
+			}
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		cancel()
+		t.Fatal("Expected SubscribeEvents to return once cancelled")
+	}
+	if events != 4*7 {
+		t.Errorf("Expected the recording to be replayed on each of 4 connections, got %d events", events)
+	}
+	// The delay before reconnecting doubles after each failure, up to the maximum
+	for i, min := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond} {
+		if gap := failures[i+1].Sub(failures[i]); gap < min {
+			t.Errorf("Expected at least %v between failures %d and %d, got %v", min, i+1, i+2, gap)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package clipv2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResourceIdentifier is a reference from one resource to another
+type ResourceIdentifier struct {
+	RID   string `json:"rid"`
+	RType string `json:"rtype"`
+}
+
+// resource holds the fields common to every type of resource
+type resource struct {
+	ID    string              `json:"id"`
+	IDv1  string              `json:"id_v1"`
+	Type  string              `json:"type"`
+	Owner *ResourceIdentifier `json:"owner"`
+}
+
+// index returns the v1 API index of a resource, e.g. 3 for "/lights/3", or 0 if it has none
+func (r resource) index() int {
+	index, err := strconv.Atoi(r.IDv1[strings.LastIndex(r.IDv1, "/")+1:])
+	if err != nil {
+		return 0
+	}
+	return index
+}
+
+// V1ID returns the v1 API ID of a resource, e.g. "3" for "/lights/3", or its v2 ID if it has none
+func (r resource) V1ID() string {
+	if r.IDv1 == "" {
+		return r.ID
+	}
+	return r.IDv1[strings.LastIndex(r.IDv1, "/")+1:]
+}
+
+// OwnerID returns the ID of the resource that owns this one, usually a device
+func (r resource) OwnerID() string {
+	if r.Owner == nil {
+		return ""
+	}
+	return r.Owner.RID
+}
+
+type metadata struct {
+	Name      string `json:"name"`
+	Archetype string `json:"archetype"`
+}
+
+// Device is a physical device, which owns services such as lights, sensors and buttons
+type Device struct {
+	resource
+	Metadata    metadata `json:"metadata"`
+	ProductData struct {
+		ModelID          string `json:"model_id"`
+		ManufacturerName string `json:"manufacturer_name"`
+		ProductName      string `json:"product_name"`
+		ProductArchetype string `json:"product_archetype"`
+		Certified        bool   `json:"certified"`
+		SoftwareVersion  string `json:"software_version"`
+	} `json:"product_data"`
+	Services []ResourceIdentifier `json:"services"`
+}
+
+// Light is a light service
+type Light struct {
+	resource
+	Metadata metadata `json:"metadata"`
+	On       struct {
+		On bool `json:"on"`
+	} `json:"on"`
+	Dimming *struct {
+		Brightness float64 `json:"brightness"`
+	} `json:"dimming"`
+	ColorTemperature *struct {
+		Mirek      *int `json:"mirek"`
+		MirekValid bool `json:"mirek_valid"`
+	} `json:"color_temperature"`
+	Color *struct {
+		XY struct {
+			X float64 `json:"x"`
+			Y float64 `json:"y"`
+		} `json:"xy"`
+	} `json:"color"`
+	Effects *struct {
+		Status string `json:"status"`
+	} `json:"effects"`
+	Mode string `json:"mode"`
+}
+
+// GroupedLight is the combined light service of a room or zone
+type GroupedLight struct {
+	resource
+	On *struct {
+		On bool `json:"on"`
+	} `json:"on"`
+	Dimming *struct {
+		Brightness float64 `json:"brightness"`
+	} `json:"dimming"`
+}
+
+// Group is a room or a zone
+type Group struct {
+	resource
+	Metadata metadata             `json:"metadata"`
+	Children []ResourceIdentifier `json:"children"`
+	Services []ResourceIdentifier `json:"services"`
+}
+
+// ZigbeeConnectivity is the state of a device's Zigbee connection
+type ZigbeeConnectivity struct {
+	resource
+	Status     string `json:"status"`
+	MACAddress string `json:"mac_address"`
+}
+
+// DevicePower is the state of a device's battery
+type DevicePower struct {
+	resource
+	PowerState struct {
+		BatteryState string `json:"battery_state"`
+		BatteryLevel int    `json:"battery_level"`
+	} `json:"power_state"`
+}
+
+// Motion is a motion sensor service
+type Motion struct {
+	resource
+	Enabled bool `json:"enabled"`
+	Motion  struct {
+		Motion       bool `json:"motion"`
+		MotionReport *struct {
+			Changed time.Time `json:"changed"`
+			Motion  bool      `json:"motion"`
+		} `json:"motion_report"`
+	} `json:"motion"`
+}
+
+// Temperature is a temperature sensor service
+type Temperature struct {
+	resource
+	Enabled     bool `json:"enabled"`
+	Temperature struct {
+		Temperature       float64 `json:"temperature"`
+		TemperatureReport *struct {
+			Changed     time.Time `json:"changed"`
+			Temperature float64   `json:"temperature"`
+		} `json:"temperature_report"`
+	} `json:"temperature"`
+}
+
+// LightLevel is a light level sensor service
+type LightLevel struct {
+	resource
+	Enabled bool `json:"enabled"`
+	Light   struct {
+		LightLevel       int `json:"light_level"`
+		LightLevelReport *struct {
+			Changed    time.Time `json:"changed"`
+			LightLevel int       `json:"light_level"`
+		} `json:"light_level_report"`
+	} `json:"light"`
+}
+
+// Button is a single button on a switch such as the dimmer switch or the tap dial
+type Button struct {
+	resource
+	Metadata struct {
+		ControlID int `json:"control_id"`
+	} `json:"metadata"`
+	Button struct {
+		LastEvent    string `json:"last_event"`
+		ButtonReport *struct {
+			Updated time.Time `json:"updated"`
+			Event   string    `json:"event"`
+		} `json:"button_report"`
+	} `json:"button"`
+}
+
+// Contact is a contact sensor service, as found in the Hue secure contact sensor
+type Contact struct {
+	resource
+	Enabled       bool `json:"enabled"`
+	ContactReport *struct {
+		Changed time.Time `json:"changed"`
+		State   string    `json:"state"`
+	} `json:"contact_report"`
+}
+
+// BridgeResource is the bridge itself
+type BridgeResource struct {
+	resource
+	BridgeID string `json:"bridge_id"`
+}
+
+// Scene is a scene, a set of states for the lights in a room or zone
+type Scene struct {
+	resource
+	Metadata metadata           `json:"metadata"`
+	Group    ResourceIdentifier `json:"group"`
+	Actions  []struct {
+		Target ResourceIdentifier `json:"target"`
+	} `json:"actions"`
+}
+
+// Resources holds every resource on the bridge, by type
+type Resources struct {
+	Bridges            []BridgeResource
+	Devices            []Device
+	Lights             []Light
+	GroupedLights      []GroupedLight
+	Rooms              []Group
+	Zones              []Group
+	ZigbeeConnectivity []ZigbeeConnectivity
+	DevicePower        []DevicePower
+	Motion             []Motion
+	Temperature        []Temperature
+	LightLevel         []LightLevel
+	Buttons            []Button
+	Contacts           []Contact
+	Scenes             []Scene
+}
+
+// add decodes a single resource of any type and adds it to the list for its type. Resources of types that
+// the exporter doesn't use are ignored.
+func (r *Resources) add(raw json.RawMessage) error {
+	var common resource
+	err := json.Unmarshal(raw, &common)
+	if err != nil {
+		return err
+	}
+
+	switch common.Type {
+	case "bridge":
+		var bridge BridgeResource
+		err = json.Unmarshal(raw, &bridge)
+		r.Bridges = append(r.Bridges, bridge)
+	case "device":
+		var device Device
+		err = json.Unmarshal(raw, &device)
+		r.Devices = append(r.Devices, device)
+	case "light":
+		var light Light
+		err = json.Unmarshal(raw, &light)
+		r.Lights = append(r.Lights, light)
+	case "grouped_light":
+		var groupedLight GroupedLight
+		err = json.Unmarshal(raw, &groupedLight)
+		r.GroupedLights = append(r.GroupedLights, groupedLight)
+	case "room":
+		var room Group
+		err = json.Unmarshal(raw, &room)
+		r.Rooms = append(r.Rooms, room)
+	case "zone":
+		var zone Group
+		err = json.Unmarshal(raw, &zone)
+		r.Zones = append(r.Zones, zone)
+	case "zigbee_connectivity":
+		var zigbee ZigbeeConnectivity
+		err = json.Unmarshal(raw, &zigbee)
+		r.ZigbeeConnectivity = append(r.ZigbeeConnectivity, zigbee)
+	case "device_power":
+		var power DevicePower
+		err = json.Unmarshal(raw, &power)
+		r.DevicePower = append(r.DevicePower, power)
+	case "motion":
+		var motion Motion
+		err = json.Unmarshal(raw, &motion)
+		r.Motion = append(r.Motion, motion)
+	case "temperature":
+		var temperature Temperature
+		err = json.Unmarshal(raw, &temperature)
+		r.Temperature = append(r.Temperature, temperature)
+	case "light_level":
+		var lightLevel LightLevel
+		err = json.Unmarshal(raw, &lightLevel)
+		r.LightLevel = append(r.LightLevel, lightLevel)
+	case "button":
+		var button Button
+		err = json.Unmarshal(raw, &button)
+		r.Buttons = append(r.Buttons, button)
+	case "contact":
+		var contact Contact
+		err = json.Unmarshal(raw, &contact)
+		r.Contacts = append(r.Contacts, contact)
+	case "scene":
+		var scene Scene
+		err = json.Unmarshal(raw, &scene)
+		r.Scenes = append(r.Scenes, scene)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to decode %s resource %s: %v", common.Type, common.ID, err)
+	}
+	return nil
+}
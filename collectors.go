@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// collectorNames are the names of the collectors of each bridge, which can be enabled and disabled with
+// `--collector.<name>` and `--no-collector.<name>`, and picked for a scrape with `collect[]`
+var collectorNames = []string{
+	"poll",
+	"bridge",
+	"groups",
+	"lights",
+	"scenes",
+	"schedules",
+	"rules",
+	"capabilities",
+	"sensors",
+	"state",
+	"switches",
+	"presence",
+	"firmware",
+	"events",
+}
+
+var (
+	collectorFlags = newCollectorFlags()
+	// disabledCollectors are the collectors that aren't created for any bridge
+	disabledCollectors = make(map[string]bool)
+)
+
+func newCollectorFlags() map[string]*bool {
+	flags := make(map[string]*bool)
+	for _, name := range collectorNames {
+		flags[name] = run.Flag("collector."+name, fmt.Sprintf("Enable the %s collector.", name)).Default("true").Bool()
+	}
+	return flags
+}
+
+// configureCollectors disables the collectors turned off by flags. It must be called after the flags are
+// parsed, and before any collectors are created.
+func configureCollectors() {
+	for name, enabled := range collectorFlags {
+		if !*enabled {
+			disabledCollectors[name] = true
+		}
+	}
+}
+
+func collectorEnabled(name string) bool {
+	return !disabledCollectors[name]
+}
+
+// namedCollectors are the collectors of a single bridge, by name
+type namedCollectors map[string]prometheus.Collector
+
+// add adds a collector, unless it's disabled
+func (c namedCollectors) add(name string, collector prometheus.Collector) {
+	if collectorEnabled(name) {
+		c[name] = collector
+	}
+}
+
+// all returns every collector, in a consistent order
+func (c namedCollectors) all() []prometheus.Collector {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]prometheus.Collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, c[name])
+	}
+	return collectors
+}
+
+// selected returns the collectors picked by name, or all of them if no names are given. Collectors that are
+// disabled, or that the bridge doesn't have, are left out.
+func (c namedCollectors) selected(names []string) []prometheus.Collector {
+	if len(names) == 0 {
+		return c.all()
+	}
+	collectors := []prometheus.Collector{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if collector, ok := c[name]; ok && !seen[name] {
+			collectors = append(collectors, collector)
+			seen[name] = true
+		}
+	}
+	return collectors
+}
+
+// register registers collectors with the registry for a single request, returning an error rather than
+// panicking if they conflict
+func register(registry *prometheus.Registry, collectors []prometheus.Collector) error {
+	for _, collector := range collectors {
+		if err := registry.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectParams returns the names of the collectors picked by the `collect[]` query parameter of a request,
+// checking that they're all known
+func collectParams(r *http.Request) ([]string, error) {
+	names := r.URL.Query()["collect[]"]
+	for _, name := range names {
+		if !contains(collectorNames, name) {
+			return nil, fmt.Errorf("Unknown collector %q", name)
+		}
+	}
+	return names, nil
+}
+
+// metricsHandler serves the metrics of every bridge. With the `collect[]` query parameter, only the named
+// collectors are gathered, so that different collectors can be scraped on different intervals. Without it,
+// everything in the default registry is served.
+func metricsHandler(targets map[string]namedCollectors) http.HandlerFunc {
+	defaultHandler := promhttp.Handler()
+	return func(w http.ResponseWriter, r *http.Request) {
+		names, err := collectParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(names) == 0 {
+			defaultHandler.ServeHTTP(w, r)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		for _, collectors := range targets {
+			if err := register(registry, collectors.selected(names)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
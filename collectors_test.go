@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/test"
+)
+
+func TestDisabledCollectors(t *testing.T) {
+	disabledCollectors["lights"] = true
+	disabledCollectors["presence"] = true
+	defer func() {
+		delete(disabledCollectors, "lights")
+		delete(disabledCollectors, "presence")
+	}()
+
+	bridge := newSnapshotBridge("test_hue", test.NewStubBridge(), "test", scrapeSnapshotMaxAge)
+	collectors := newCollectors(bridge, "test", &BridgeConfig{})
+	for _, name := range []string{"lights", "presence"} {
+		if _, ok := collectors[name]; ok {
+			t.Errorf("Expected no %s collector", name)
+		}
+	}
+	for _, name := range []string{"groups", "sensors", "state"} {
+		if _, ok := collectors[name]; !ok {
+			t.Errorf("Expected a %s collector", name)
+		}
+	}
+	// The energy meter and the presence tracker don't observe snapshots, but the state tracker and the
+	// others do
+	if len(bridge.observers) != 3 {
+		t.Errorf("Expected 3 observers, got %d", len(bridge.observers))
+	}
+}
+
+func TestMetricsHandlerCollect(t *testing.T) {
+	daylight := hue.Sensor{Name: "Daylight", Type: "Daylight"}
+	daylight.State.LastUpdated = hue.UpdateTime{Time: &time.Time{}}
+	stub := test.NewStubBridge().
+		WithLights([]hue.Light{{Name: "Hallway", Type: "Extended color light"}}).
+		WithSensors([]hue.Sensor{daylight})
+	handler := metricsHandler(map[string]namedCollectors{
+		"house": newCollectors(newSnapshotBridge("test_hue", stub, "house", scrapeSnapshotMaxAge), "house", &BridgeConfig{}),
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/metrics?collect[]=sensors", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "hue_sensor_info") {
+		t.Errorf("Expected sensor metrics, got:\n%s", body)
+	}
+	if strings.Contains(body, "hue_light_") {
+		t.Errorf("Expected no light metrics, got:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/metrics?collect[]=sensors&collect[]=lights", nil))
+	body = rec.Body.String()
+	if !strings.Contains(body, "hue_sensor_info") || !strings.Contains(body, "hue_light_info") {
+		t.Errorf("Expected sensor and light metrics, got:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/metrics?collect[]=bulbs", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown collector, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestMetricsHandlerConflict(t *testing.T) {
+	// Two bridges with the same name have the same descriptors, which can't be registered together
+	stub := test.NewStubBridge()
+	handler := metricsHandler(map[string]namedCollectors{
+		"a": newCollectors(newSnapshotBridge("test_hue", stub, "house", scrapeSnapshotMaxAge), "house", &BridgeConfig{}),
+		"b": newCollectors(newSnapshotBridge("test_hue", stub, "house", scrapeSnapshotMaxAge), "house", &BridgeConfig{}),
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/metrics?collect[]=sensors", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
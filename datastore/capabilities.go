@@ -0,0 +1,59 @@
+package datastore
+
+import (
+	"encoding/json"
+
+	hue "github.com/collinux/gohue"
+)
+
+// Capacity is how many of a kind of resource a bridge can store, and how many more it has room for
+type Capacity struct {
+	Available int `json:"available"`
+	Total     int `json:"total"`
+}
+
+// Capabilities is the capacity of a bridge for each kind of resource, as returned by
+// `GET /api/<username>/capabilities`. Kinds of resource are named by their path in the response, e.g.
+// "rules" for rules and "rules.conditions" for the conditions of all rules.
+type Capabilities map[string]Capacity
+
+// UnmarshalJSON decodes the capabilities response, in which any object with a total is a capacity
+func (c *Capabilities) UnmarshalJSON(b []byte) error {
+	*c = make(Capabilities)
+	return c.add("", b)
+}
+
+func (c Capabilities) add(prefix string, b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		// Not every value is an object, e.g. the number of streaming channels
+		return nil
+	}
+	if _, ok := raw["total"]; ok {
+		var capacity Capacity
+		if err := json.Unmarshal(b, &capacity); err != nil {
+			return err
+		}
+		c[prefix] = capacity
+	}
+	for name, value := range raw {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if err := c.add(path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchCapabilities retrieves the capacity of a bridge that has been logged in to
+func FetchCapabilities(bridge *hue.Bridge) (Capabilities, error) {
+	var c Capabilities
+	err := get(bridge, "/capabilities", &c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,51 @@
+package datastore
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestFetchCapabilities(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/capabilities.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge, close := newTestBridge(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/key/capabilities" {
+			t.Errorf("Unexpected request for %v", r.URL.Path)
+		}
+		w.Write(raw)
+	})
+	defer close()
+
+	c, err := FetchCapabilities(bridge)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := Capabilities{
+		"lights":             {Available: 61, Total: 63},
+		"sensors":            {Available: 245, Total: 250},
+		"sensors.clip":       {Available: 245, Total: 250},
+		"sensors.zll":        {Available: 62, Total: 64},
+		"sensors.zgp":        {Available: 62, Total: 64},
+		"groups":             {Available: 63, Total: 64},
+		"scenes":             {Available: 199, Total: 200},
+		"scenes.lightstates": {Available: 12599, Total: 12600},
+		"schedules":          {Available: 99, Total: 100},
+		"rules":              {Available: 249, Total: 250},
+		"rules.conditions":   {Available: 1498, Total: 1500},
+		"rules.actions":      {Available: 999, Total: 1000},
+		"resourcelinks":      {Available: 64, Total: 64},
+		"streaming":          {Available: 1, Total: 1},
+	}
+	if len(c) != len(expected) {
+		t.Errorf("Expected %v capacities, got %+v", len(expected), c)
+	}
+	for name, capacity := range expected {
+		if c[name] != capacity {
+			t.Errorf("Expected %+v for %v, got %+v", capacity, name, c[name])
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Package datastore fetches the whole datastore of a Hue bridge from the v1 API in a single request, so that
+// lights, groups, sensors and everything else are all seen at the same moment.
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	hue "github.com/collinux/gohue"
+)
+
+var client = &http.Client{Timeout: time.Second * 5}
+
+// Datastore is the full state of a bridge, as returned by `GET /api/<username>`
+type Datastore struct {
+	Lights    []hue.Light
+	Groups    []hue.Group
+	Sensors   []hue.Sensor
+	Config    Config
+	Scenes    []hue.Scene
+	Schedules []Schedule
+	Rules     []Rule
+	// LightUpdates is the software update state of each light, by its unique ID, which gohue's lights leave out
+	LightUpdates map[string]SoftwareUpdate
+	// IDs are the v2 IDs of lights, groups and sensors that were converted from the v2 API without a v1 ID
+	IDs     IDs
+	Fetched time.Time // When the datastore was requested from the bridge
+}
+
+// SoftwareUpdate is the state of a device's software update process
+type SoftwareUpdate struct {
+	State       string `json:"state"`       // noupdates, transferring, readytoinstall, installing or notupdatable
+	LastInstall string `json:"lastinstall"` // Time the software was last updated, in UTC
+}
+
+// TimeFormat is the format of times in the v1 API, which are in UTC unless noted otherwise
+const TimeFormat = "2006-01-02T15:04:05"
+
+// ParseTime parses a time from the v1 API. Times that have never happened are reported by the bridge as
+// "none", which is returned as the zero time.
+func ParseTime(value string) (time.Time, error) {
+	if value == "" || value == "none" {
+		return time.Time{}, nil
+	}
+	return time.Parse(TimeFormat, value)
+}
+
+// Config is the bridge configuration. Sections that a bridge doesn't report are nil.
+type Config struct {
+	Name             string               `json:"name"`
+	BridgeID         string               `json:"bridgeid"`
+	ModelID          string               `json:"modelid"`
+	MAC              string               `json:"mac"`
+	APIVersion       string               `json:"apiversion"`
+	SWVersion        string               `json:"swversion"`
+	ZigbeeChannel    int                  `json:"zigbeechannel"`
+	UTC              string               `json:"UTC"`       // Current time on the bridge, in UTC
+	LocalTime        string               `json:"localtime"` // Current time on the bridge, in its time zone
+	TimeZone         string               `json:"timezone"`
+	PortalConnection string               `json:"portalconnection"`
+	Whitelist        map[string]Whitelist `json:"whitelist"`
+	PortalState      *struct {
+		SignedOn      bool   `json:"signedon"`
+		Incoming      bool   `json:"incoming"`
+		Outgoing      bool   `json:"outgoing"`
+		Communication string `json:"communication"`
+	} `json:"portalstate"`
+	// InternetServices is the connectivity of each of the bridge's internet services, "connected" or
+	// "disconnected"
+	InternetServices map[string]string `json:"internetservices"`
+	SWUpdate2        *struct {
+		State      string `json:"state"` // noupdates, transferring, anyreadytoinstall, allreadytoinstall or installing
+		LastChange string `json:"lastchange"`
+		Bridge     struct {
+			State       string `json:"state"`
+			LastInstall string `json:"lastinstall"`
+		} `json:"bridge"`
+		AutoInstall struct {
+			On         bool   `json:"on"`
+			UpdateTime string `json:"updatetime"`
+		} `json:"autoinstall"`
+	} `json:"swupdate2"`
+}
+
+// Whitelist is a user of the API
+type Whitelist struct {
+	Name       string `json:"name"`
+	LastUse    string `json:"last use date"`
+	CreateDate string `json:"create date"`
+}
+
+// Schedule is a schedule, such as an alarm or a timer. gohue's schedule lacks the time that timers were
+// started, which is needed to know when they will go off.
+type Schedule struct {
+	hue.Schedule
+	StartTime string `json:"starttime"` // Time a timer was started, in UTC
+}
+
+// Rule is a rule in the bridge's rules engine
+type Rule struct {
+	Name           string      `json:"name"`
+	Owner          string      `json:"owner"`
+	Created        string      `json:"created"`
+	LastTriggered  string      `json:"lasttriggered"`
+	TimesTriggered int         `json:"timestriggered"`
+	Status         string      `json:"status"`
+	Recycle        bool        `json:"recycle"`
+	Conditions     []Condition `json:"conditions"`
+	Actions        []Action    `json:"actions"`
+	ID             string      // Set by the key of the rule in the rules response
+}
+
+// Condition is a condition of a rule, which must be met for the rule to trigger
+type Condition struct {
+	Address  string `json:"address"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// Action is an action performed when a rule triggers
+type Action struct {
+	Address string                 `json:"address"`
+	Method  string                 `json:"method"`
+	Body    map[string]interface{} `json:"body"`
+}
+
+// UnmarshalJSON decodes the full datastore response, in which every type of resource is an object keyed by
+// its ID, into lists of resources.
+func (d *Datastore) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Lights    map[string]hue.Light  `json:"lights"`
+		Groups    map[string]hue.Group  `json:"groups"`
+		Sensors   map[string]hue.Sensor `json:"sensors"`
+		Config    Config                `json:"config"`
+		Scenes    map[string]hue.Scene  `json:"scenes"`
+		Schedules map[string]Schedule   `json:"schedules"`
+		Rules     map[string]Rule       `json:"rules"`
+	}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+	var lightUpdates struct {
+		Lights map[string]struct {
+			UniqueID string         `json:"uniqueid"`
+			SWUpdate SoftwareUpdate `json:"swupdate"`
+		} `json:"lights"`
+	}
+	err = json.Unmarshal(b, &lightUpdates)
+	if err != nil {
+		return err
+	}
+
+	*d = Datastore{
+		Lights:    make([]hue.Light, 0, len(raw.Lights)),
+		Groups:    make([]hue.Group, 0, len(raw.Groups)),
+		Sensors:   make([]hue.Sensor, 0, len(raw.Sensors)),
+		Config:    raw.Config,
+		Scenes:    make([]hue.Scene, 0, len(raw.Scenes)),
+		Schedules: make([]Schedule, 0, len(raw.Schedules)),
+		Rules:     make([]Rule, 0, len(raw.Rules)),
+
+		LightUpdates: make(map[string]SoftwareUpdate),
+	}
+	for id, light := range raw.Lights {
+		if light.Index, err = strconv.Atoi(id); err != nil {
+			return fmt.Errorf("unable to convert light index %q to integer", id)
+		}
+		d.Lights = append(d.Lights, light)
+	}
+	for _, light := range lightUpdates.Lights {
+		if light.SWUpdate.State != "" {
+			d.LightUpdates[light.UniqueID] = light.SWUpdate
+		}
+	}
+	for id, group := range raw.Groups {
+		if group.Index, err = strconv.Atoi(id); err != nil {
+			return fmt.Errorf("unable to convert group index %q to integer", id)
+		}
+		d.Groups = append(d.Groups, group)
+	}
+	for id, sensor := range raw.Sensors {
+		if sensor.Index, err = strconv.Atoi(id); err != nil {
+			return fmt.Errorf("unable to convert sensor index %q to integer", id)
+		}
+		d.Sensors = append(d.Sensors, sensor)
+	}
+	for id, scene := range raw.Scenes {
+		scene.ID = id
+		d.Scenes = append(d.Scenes, scene)
+	}
+	for id, schedule := range raw.Schedules {
+		schedule.ID = id
+		d.Schedules = append(d.Schedules, schedule)
+	}
+	for id, rule := range raw.Rules {
+		rule.ID = id
+		d.Rules = append(d.Rules, rule)
+	}
+	return nil
+}
+
+// Fetch retrieves the full datastore from a bridge that has been logged in to
+func Fetch(bridge *hue.Bridge) (*Datastore, error) {
+	var d Datastore
+	fetched := time.Now()
+	err := get(bridge, "", &d)
+	if err != nil {
+		return nil, err
+	}
+	d.Fetched = fetched
+	for i := range d.Lights {
+		d.Lights[i].Bridge = bridge
+	}
+	for i := range d.Groups {
+		d.Groups[i].Bridge = bridge
+	}
+	for i := range d.Sensors {
+		d.Sensors[i].Bridge = bridge
+	}
+	return &d, nil
+}
+
+// apiError is the format of errors returned by the v1 API, which always responds with status 200
+type apiError struct {
+	Error *struct {
+		Type        int    `json:"type"`
+		Address     string `json:"address"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// get decodes the resource at path, relative to the API root for the bridge's user, into v
+func get(bridge *hue.Bridge, path string, v interface{}) error {
+	resp, err := client.Get(fmt.Sprintf("http://%s/api/%s%s", bridge.IPAddress, bridge.Username, path))
+	if err != nil {
+		return fmt.Errorf("unable to access bridge: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return Decode(body, v)
+}
+
+// Decode decodes a response from the v1 API into v, or returns the error that the bridge responded with
+func Decode(body []byte, v interface{}) error {
+	var errs []apiError
+	if json.Unmarshal(body, &errs) == nil && len(errs) > 0 && errs[0].Error != nil {
+		return fmt.Errorf("error type %d: %s", errs[0].Error.Type, errs[0].Error.Description)
+	}
+	return json.Unmarshal(body, v)
+}
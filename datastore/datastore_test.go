@@ -0,0 +1,91 @@
+package datastore
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	hue "github.com/collinux/gohue"
+)
+
+func newTestBridge(t *testing.T, handler http.HandlerFunc) (*hue.Bridge, func()) {
+	server := httptest.NewServer(handler)
+	bridge := &hue.Bridge{
+		IPAddress: strings.TrimPrefix(server.URL, "http://"),
+		Username:  "key",
+	}
+	return bridge, server.Close
+}
+
+func TestFetch(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/datastore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge, close := newTestBridge(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/key" {
+			t.Errorf("Unexpected request for %v", r.URL.Path)
+		}
+		w.Write(raw)
+	})
+	defer close()
+
+	d, err := Fetch(bridge)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(d.Lights) != 1 || d.Lights[0].Index != 1 || d.Lights[0].Name != "Hallway" || d.Lights[0].Bridge != bridge {
+		t.Errorf("Unexpected lights: %+v", d.Lights)
+	}
+	if update := d.LightUpdates["00:17:88:01:03:aa:bb:cc-0b"]; update.State != "readytoinstall" || update.LastInstall != "2019-03-11T10:22:35" {
+		t.Errorf("Unexpected light updates: %+v", d.LightUpdates)
+	}
+	if len(d.Groups) != 1 || d.Groups[0].Index != 1 || len(d.Groups[0].Lights) != 1 {
+		t.Errorf("Unexpected groups: %+v", d.Groups)
+	}
+	if len(d.Sensors) != 1 || d.Sensors[0].Index != 2 || d.Sensors[0].State.ButtonEvent != 1002 {
+		t.Errorf("Unexpected sensors: %+v", d.Sensors)
+	}
+	if d.Config.BridgeID != "001788FFFE23BFC2" || d.Config.ZigbeeChannel != 15 || len(d.Config.Whitelist) != 2 || d.Config.SWUpdate2.State != "anyreadytoinstall" {
+		t.Errorf("Unexpected config: %+v", d.Config)
+	}
+	if len(d.Scenes) != 1 || d.Scenes[0].ID != "abc" || !d.Scenes[0].Locked {
+		t.Errorf("Unexpected scenes: %+v", d.Scenes)
+	}
+	if len(d.Schedules) != 1 || d.Schedules[0].ID != "1" || d.Schedules[0].Localtime != "W124/T07:00:00" {
+		t.Errorf("Unexpected schedules: %+v", d.Schedules)
+	}
+	if len(d.Rules) != 1 || d.Rules[0].TimesTriggered != 42 || len(d.Rules[0].Conditions) != 2 || len(d.Rules[0].Actions) != 1 {
+		t.Errorf("Unexpected rules: %+v", d.Rules)
+	}
+}
+
+func TestFetchUnauthorized(t *testing.T) {
+	bridge, close := newTestBridge(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"error":{"type":1,"address":"/","description":"unauthorized user"}}]`))
+	})
+	defer close()
+
+	_, err := Fetch(bridge)
+	if err == nil || !strings.Contains(err.Error(), "unauthorized user") {
+		t.Errorf("Expected an unauthorized user error, got %v", err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	parsed, err := ParseTime("2018-09-12T18:40:51")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parsed.Unix() != 1536777651 {
+		t.Errorf("Expected 1536777651, got %v", parsed.Unix())
+	}
+
+	parsed, err = ParseTime("none")
+	if err != nil || !parsed.IsZero() {
+		t.Errorf("Expected the zero time for none, got %v, %v", parsed, err)
+	}
+}
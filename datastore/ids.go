@@ -0,0 +1,49 @@
+package datastore
+
+import (
+	"strconv"
+
+	hue "github.com/collinux/gohue"
+)
+
+// IDs are the v2 IDs of the lights, groups and sensors of a datastore converted from the v2 API that have no
+// v1 ID. Each of them is given a negative index in place of one, unique within its datastore, which its v2 ID
+// is kept under.
+type IDs struct {
+	Lights  map[int]string
+	Groups  map[int]string
+	Sensors map[int]string
+}
+
+// NewIDs creates an empty set of v2 IDs
+func NewIDs() IDs {
+	return IDs{
+		Lights:  make(map[int]string),
+		Groups:  make(map[int]string),
+		Sensors: make(map[int]string),
+	}
+}
+
+// Light returns the ID of a light in the v1 API, or its v2 ID if it has none
+func (ids IDs) Light(light hue.Light) string {
+	return lookup(ids.Lights, light.Index)
+}
+
+// Group returns the ID of a group in the v1 API, or the v2 ID of the room or zone it was converted from if it
+// has none
+func (ids IDs) Group(group hue.Group) string {
+	return lookup(ids.Groups, group.Index)
+}
+
+// Sensor returns the ID of a sensor in the v1 API, or the v2 ID of the service it was converted from if it
+// has none
+func (ids IDs) Sensor(sensor hue.Sensor) string {
+	return lookup(ids.Sensors, sensor.Index)
+}
+
+func lookup(ids map[int]string, index int) string {
+	if id, ok := ids[index]; ok {
+		return id
+	}
+	return strconv.Itoa(index)
+}
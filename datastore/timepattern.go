@@ -0,0 +1,147 @@
+package datastore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimePatternKind is the kind of a time pattern
+type TimePatternKind int
+
+const (
+	// AbsoluteTime happens once, at a date and time
+	AbsoluteTime TimePatternKind = iota
+	// WeeklyTime happens at a time of day, on some days of the week
+	WeeklyTime
+	// Timer happens a duration after it was started, possibly repeatedly
+	Timer
+)
+
+// TimePattern is a time in the pattern syntax that the v1 API uses for schedules:
+//
+//	2018-09-12T07:00:00     an absolute time
+//	W127/T07:00:00          a time of day, on the days of the week in the bitmask (64 = Monday, 1 = Sunday)
+//	PT00:30:00              a timer
+//	R/PT00:30:00            a timer that repeats forever
+//	R05/PT00:30:00          a timer that repeats 5 times
+//
+// Any of these may have a random offset of up to a duration added, e.g. "W127/T07:00:00A00:30:00".
+type TimePattern struct {
+	Kind         TimePatternKind
+	Time         time.Time      // For absolute times
+	Weekdays     int            // For weekly times, the bitmask of days
+	TimeOfDay    time.Duration  // For weekly times, the time since midnight
+	Location     *time.Location // For weekly times, the location of the time of day
+	Duration     time.Duration  // For timers
+	Repeats      bool           // For timers, whether they repeat
+	Recurrences  int            // For repeating timers, the number of times they repeat, or 0 for forever
+	RandomOffset time.Duration  // The maximum random offset
+}
+
+// ParseTimePattern parses a time pattern. Absolute and weekly times are in loc.
+func ParseTimePattern(value string, loc *time.Location) (*TimePattern, error) {
+	pattern := TimePattern{Location: loc}
+	rest := value
+	var err error
+
+	if i := strings.Index(rest, "A"); i >= 0 {
+		pattern.RandomOffset, err = parseClock(rest[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid random offset in time pattern %q: %v", value, err)
+		}
+		rest = rest[:i]
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "W"):
+		pattern.Kind = WeeklyTime
+		parts := strings.SplitN(rest[1:], "/T", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid weekly time pattern %q", value)
+		}
+		pattern.Weekdays, err = strconv.Atoi(parts[0])
+		if err != nil || pattern.Weekdays < 1 || pattern.Weekdays > 127 {
+			return nil, fmt.Errorf("invalid days of the week in time pattern %q", value)
+		}
+		pattern.TimeOfDay, err = parseClock(parts[1])
+	case strings.HasPrefix(rest, "R"):
+		pattern.Kind = Timer
+		pattern.Repeats = true
+		parts := strings.SplitN(rest[1:], "/", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "PT") {
+			return nil, fmt.Errorf("invalid recurring timer pattern %q", value)
+		}
+		if parts[0] != "" {
+			pattern.Recurrences, err = strconv.Atoi(parts[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid number of recurrences in time pattern %q", value)
+			}
+		}
+		pattern.Duration, err = parseClock(parts[1][2:])
+	case strings.HasPrefix(rest, "PT"):
+		pattern.Kind = Timer
+		pattern.Duration, err = parseClock(rest[2:])
+	default:
+		pattern.Kind = AbsoluteTime
+		pattern.Time, err = time.ParseInLocation(TimeFormat, rest, loc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid time pattern %q: %v", value, err)
+	}
+	return &pattern, nil
+}
+
+// parseClock parses a duration written as a time of day, "hh:mm:ss"
+func parseClock(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("expected hh:mm:ss, got %q", value)
+	}
+	var duration time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("expected hh:mm:ss, got %q", value)
+		}
+		duration += time.Duration(n) * unit
+	}
+	return duration, nil
+}
+
+// Next returns the earliest time after now that the pattern could happen, before any random offset, and
+// whether it will happen again at all. Timers count from start, the time they were started.
+func (p *TimePattern) Next(now time.Time, start time.Time) (time.Time, bool) {
+	switch p.Kind {
+	case AbsoluteTime:
+		return p.Time, p.Time.After(now)
+	case WeeklyTime:
+		local := now.In(p.Location)
+		clock := int(p.TimeOfDay / time.Second)
+		for day := 0; day <= 7; day++ {
+			next := time.Date(local.Year(), local.Month(), local.Day()+day, clock/3600, clock/60%60, clock%60, 0, local.Location())
+			// Monday is the most significant of the seven bits, Sunday the least
+			if p.Weekdays&(1<<uint((7-next.Weekday())%7)) != 0 && next.After(now) {
+				return next, true
+			}
+		}
+	case Timer:
+		if start.IsZero() || p.Duration <= 0 {
+			return time.Time{}, false
+		}
+		if !p.Repeats {
+			next := start.Add(p.Duration)
+			return next, next.After(now)
+		}
+		n := 1
+		if now.After(start) {
+			n = int(now.Sub(start)/p.Duration) + 1
+		}
+		if p.Recurrences > 0 && n > p.Recurrences {
+			return time.Time{}, false
+		}
+		return start.Add(time.Duration(n) * p.Duration), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,61 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimePattern(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("No time zone database")
+	}
+	// A Wednesday
+	now := time.Date(2018, 9, 12, 18, 41, 0, 0, time.UTC)
+	started := time.Date(2018, 9, 12, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		pattern string
+		next    time.Time
+		ok      bool
+	}{
+		{"2018-09-13T07:00:00", time.Date(2018, 9, 13, 6, 0, 0, 0, time.UTC), true},
+		{"2018-09-12T07:00:00", time.Date(2018, 9, 12, 6, 0, 0, 0, time.UTC), false},
+		{"2018-09-13T07:00:00A00:30:00", time.Date(2018, 9, 13, 6, 0, 0, 0, time.UTC), true},
+		{"W127/T07:00:00", time.Date(2018, 9, 13, 6, 0, 0, 0, time.UTC), true},
+		{"W127/T20:00:00", time.Date(2018, 9, 12, 19, 0, 0, 0, time.UTC), true},
+		{"W124/T07:00:00", time.Date(2018, 9, 13, 6, 0, 0, 0, time.UTC), true},
+		{"W3/T10:00:00A00:15:00", time.Date(2018, 9, 15, 9, 0, 0, 0, time.UTC), true},
+		{"W32/T19:00:00", time.Date(2018, 9, 18, 18, 0, 0, 0, time.UTC), true},
+		{"W64/T07:00:00", time.Date(2018, 10, 29, 7, 0, 0, 0, time.UTC), true},
+		{"PT00:30:00", time.Date(2018, 9, 12, 18, 30, 0, 0, time.UTC), false},
+		{"PT01:00:00", time.Date(2018, 9, 12, 19, 0, 0, 0, time.UTC), true},
+		{"R/PT00:15:00", time.Date(2018, 9, 12, 18, 45, 0, 0, time.UTC), true},
+		{"R03/PT00:15:00", time.Date(2018, 9, 12, 18, 45, 0, 0, time.UTC), true},
+		{"R02/PT00:15:00", time.Time{}, false},
+	}
+	for _, test := range tests {
+		pattern, err := ParseTimePattern(test.pattern, london)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %v: %v", test.pattern, err)
+			continue
+		}
+		from := now
+		if test.pattern == "W64/T07:00:00" {
+			// The Sunday before the first Monday after the clocks go back
+			from = time.Date(2018, 10, 28, 12, 0, 0, 0, time.UTC)
+		}
+		next, ok := pattern.Next(from, started)
+		if ok != test.ok || (ok && !next.Equal(test.next)) {
+			t.Errorf("Expected %v to next happen at %v (%v), got %v (%v)", test.pattern, test.next, test.ok, next, ok)
+		}
+	}
+}
+
+func TestParseTimePatternInvalid(t *testing.T) {
+	for _, value := range []string{"", "W/T07:00:00", "W200/T07:00:00", "W127/07:00:00", "PT00:30", "R/T00:30:00", "Rx/PT00:30:00", "W127/T07:00:00A1"} {
+		if _, err := ParseTimePattern(value, time.UTC); err == nil {
+			t.Errorf("Expected an error parsing %q", value)
+		}
+	}
+}
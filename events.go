@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mitchellrj/hue_exporter/clipv2"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/prometheus/common/log"
+)
+
+// buttonDetails identifies a button for its event counters
+type buttonDetails struct {
+	id     string
+	name   string
+	button string
+}
+
+// motionDetails identifies a motion sensor for its event counter
+type motionDetails struct {
+	id   string
+	name string
+}
+
+// eventCollector counts events from the CLIP v2 event stream of a bridge, so that button presses and motion
+// between scrapes are seen as well as the state at the time of the scrape
+type eventCollector struct {
+	bridge *clipv2.Bridge
+
+	// mutex guards the details of buttons and motion sensors, by service ID
+	mutex         sync.RWMutex
+	buttons       map[string]buttonDetails
+	motionSensors map[string]motionDetails
+	// refreshed is when the details were last looked up, so that events from unknown services don't look
+	// them up again more than once every namesRefreshInterval
+	refreshed time.Time
+
+	buttonEvents  *prometheus.CounterVec
+	motionEvents  *prometheus.CounterVec
+	unknownEvents prometheus.Counter
+	streamErrors  prometheus.Counter
+}
+
+// eventData holds the parts of a changed resource that the event collector counts
+type eventData struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Button *struct {
+		LastEvent    string `json:"last_event"`
+		ButtonReport *struct {
+			Event string `json:"event"`
+		} `json:"button_report"`
+	} `json:"button"`
+	Motion *struct {
+		Motion bool `json:"motion"`
+	} `json:"motion"`
+}
+
+// namesRefreshInterval is the least time between lookups of the details of buttons and motion sensors
+// caused by events from services that aren't known
+const namesRefreshInterval = time.Minute
+
+var (
+	buttonEventLabelNames = []string{"id", "name", "button", "event"}
+	motionEventLabelNames = []string{"id", "name"}
+)
+
+// newEventCollector Create a new Hue collector for events from the event stream of a CLIP v2 bridge
+func newEventCollector(namespace string, bridge *clipv2.Bridge, bridgeName string) *eventCollector {
+	return &eventCollector{
+		bridge:        bridge,
+		buttons:       make(map[string]buttonDetails),
+		motionSensors: make(map[string]motionDetails),
+		buttonEvents: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "button",
+				Name:        "events_total",
+				Help:        "Count of button events received from the bridge event stream",
+				ConstLabels: constLabels(bridgeName),
+			},
+			omitNameLabelNames(buttonEventLabelNames, "name"),
+		),
+		motionEvents: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "motion",
+				Name:        "events_total",
+				Help:        "Count of motion detections received from the bridge event stream",
+				ConstLabels: constLabels(bridgeName),
+			},
+			omitNameLabelNames(motionEventLabelNames, "name"),
+		),
+		unknownEvents: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "event_stream",
+				Name:        "unknown_events_total",
+				Help:        "Count of button and motion events from the bridge event stream that weren't counted, as their button or motion sensor wasn't known yet",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+		streamErrors: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "event_stream",
+				Name:        "errors_total",
+				Help:        "Count of failures of the connection to the bridge event stream",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+	}
+}
+
+// run streams events from the bridge until ctx is cancelled
+func (c *eventCollector) run(ctx context.Context) {
+	c.refreshNames()
+	c.bridge.SubscribeEvents(ctx, c.handle, func(err error) {
+		log.Errorf("Event stream failed: %v", err)
+		c.streamErrors.Inc()
+	})
+}
+
+// refreshNamesForUnknown looks up the details of buttons and motion sensors again in the background after an
+// event from a service that isn't known, so that reading the event stream isn't held up, unless they were
+// looked up within namesRefreshInterval
+func (c *eventCollector) refreshNamesForUnknown() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if time.Since(c.refreshed) < namesRefreshInterval {
+		return
+	}
+	c.refreshed = time.Now()
+	go c.lookUpNames()
+}
+
+// refreshNames looks up the names of the devices that own each button and motion sensor
+func (c *eventCollector) refreshNames() {
+	c.mutex.Lock()
+	c.refreshed = time.Now()
+	c.mutex.Unlock()
+	c.lookUpNames()
+}
+
+// lookUpNames fetches the details of every button and motion sensor from the bridge
+func (c *eventCollector) lookUpNames() {
+	resources, err := c.bridge.GetResources()
+	if err != nil {
+		log.Errorf("Failed to look up devices for events: %v", err)
+		return
+	}
+	names := make(map[string]string)
+	for _, device := range resources.Devices {
+		names[device.ID] = device.Metadata.Name
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, button := range resources.Buttons {
+		c.buttons[button.ID] = buttonDetails{
+			id:     button.V1ID(),
+			name:   names[button.OwnerID()],
+			button: strconv.Itoa(button.Metadata.ControlID),
+		}
+	}
+	for _, motion := range resources.Motion {
+		c.motionSensors[motion.ID] = motionDetails{id: motion.V1ID(), name: names[motion.OwnerID()]}
+	}
+}
+
+func (c *eventCollector) handle(event clipv2.Event) {
+	if event.Type != "update" {
+		return
+	}
+	for _, raw := range event.Data {
+		var data eventData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			log.Errorf("Failed to decode event: %v", err)
+			continue
+		}
+		switch {
+		case data.Type == "button" && data.Button != nil:
+			button, ok := c.button(data.ID)
+			if !ok {
+				c.unknownEvents.Inc()
+				c.refreshNamesForUnknown()
+				continue
+			}
+			action := data.Button.LastEvent
+			if data.Button.ButtonReport != nil {
+				action = data.Button.ButtonReport.Event
+			}
+			c.buttonEvents.With(omitNameLabel(prometheus.Labels{
+				"id":     button.id,
+				"name":   button.name,
+				"button": button.button,
+				"event":  action,
+			}, "name")).Inc()
+		case data.Type == "motion" && data.Motion != nil && data.Motion.Motion:
+			motion, ok := c.motionSensor(data.ID)
+			if !ok {
+				c.unknownEvents.Inc()
+				c.refreshNamesForUnknown()
+				continue
+			}
+			c.motionEvents.With(omitNameLabel(prometheus.Labels{"id": motion.id, "name": motion.name}, "name")).Inc()
+		}
+	}
+}
+
+func (c *eventCollector) button(id string) (buttonDetails, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	button, ok := c.buttons[id]
+	return button, ok
+}
+
+func (c *eventCollector) motionSensor(id string) (motionDetails, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	motion, ok := c.motionSensors[id]
+	return motion, ok
+}
+
+func (c *eventCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.buttonEvents.Describe(ch)
+	c.motionEvents.Describe(ch)
+	c.unknownEvents.Describe(ch)
+	c.streamErrors.Describe(ch)
+}
+
+func (c *eventCollector) Collect(ch chan<- prometheus.Metric) {
+	c.buttonEvents.Collect(ch)
+	c.motionEvents.Collect(ch)
+	c.unknownEvents.Collect(ch)
+	c.streamErrors.Collect(ch)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellrj/hue_exporter/clipv2"
+	"github.com/mitchellrj/hue_exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestEventCollector(t *testing.T) {
+	resources, err := ioutil.ReadFile("clipv2/testdata/resources.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recording, err := ioutil.ReadFile("clipv2/testdata/eventstream.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := test.NewCLIPv2ServerWithEvents("key", resources, recording)
+	defer server.Close()
+	bridge, err := clipv2.NewBridge(strings.TrimPrefix(server.URL, "https://"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bridge.Login("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := newEventCollector("test_hue", bridge, "test")
+	collector.refreshNames()
+	bridge.StreamEvents(context.Background(), collector.handle)
+
+	expected := map[string]float64{
+		"8/Dimmer switch/1/initial_press": 1,
+		"8/Dimmer switch/1/short_release": 1,
+		"8/Dimmer switch/4/repeat":        1,
+	}
+	for key, value := range expected {
+		labels := strings.Split(key, "/")
+		if actual := counterValue(t, collector.buttonEvents.WithLabelValues(labels...)); actual != value {
+			t.Errorf("Expected %v events for %v, got %v", value, key, actual)
+		}
+	}
+	if actual := counterValue(t, collector.motionEvents.WithLabelValues("5", "Hallway sensor")); actual != 2 {
+		t.Errorf("Expected 2 motion events, got %v", actual)
+	}
+}
+
+func TestEventCollectorUnknownServices(t *testing.T) {
+	// With no bridge to look details up from, a lookup would panic
+	collector := newEventCollector("test_hue", nil, "test")
+	collector.refreshed = time.Now()
+
+	collector.handle(clipv2.Event{Type: "update", Data: []json.RawMessage{
+		json.RawMessage(`{"id":"btn-9","type":"button","button":{"last_event":"initial_press"}}`),
+		json.RawMessage(`{"id":"m-9","type":"motion","motion":{"motion":true}}`),
+	}})
+
+	if actual := counterValue(t, collector.unknownEvents); actual != 2 {
+		t.Errorf("Expected the events from the unknown button and motion sensor to be counted as unknown, got %v", actual)
+	}
+	metrics := make(chan prometheus.Metric, 10)
+	collector.buttonEvents.Collect(metrics)
+	collector.motionEvents.Collect(metrics)
+	close(metrics)
+	if len(metrics) != 0 {
+		t.Errorf("Expected no button or motion events to be counted, got %d", len(metrics))
+	}
+}
+
+func TestEventCollectorLooksUpUnknownServicesInBackground(t *testing.T) {
+	resources, err := ioutil.ReadFile("clipv2/testdata/resources.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := test.NewCLIPv2Server("key", resources)
+	defer server.Close()
+	bridge, err := clipv2.NewBridge(strings.TrimPrefix(server.URL, "https://"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bridge.Login("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := newEventCollector("test_hue", bridge, "test")
+	collector.handle(clipv2.Event{Type: "update", Data: []json.RawMessage{
+		json.RawMessage(`{"id":"btn-1","type":"button","button":{"last_event":"initial_press"}}`),
+	}})
+	if actual := counterValue(t, collector.unknownEvents); actual != 1 {
+		t.Errorf("Expected the event to be counted as unknown, got %v", actual)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, ok := collector.button("btn-1"); ok {
+			return
+		}
+	}
+	t.Error("Expected the button to be looked up")
+}
+
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	var metric dto.Metric
+	if err := counter.Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
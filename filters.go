@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+)
+
+// deviceMatcher matches lights, groups or sensors on every one of the fields that it sets
+type deviceMatcher struct {
+	deviceType   string
+	name         *regexp.Regexp
+	modelID      string
+	manufacturer string
+	uniqueID     string
+}
+
+func newDeviceMatcher(cfg DeviceMatchConfig) (deviceMatcher, error) {
+	m := deviceMatcher{
+		deviceType:   cfg.Type,
+		modelID:      cfg.ModelID,
+		manufacturer: cfg.Manufacturer,
+		uniqueID:     cfg.UniqueID,
+	}
+	if cfg.Name != "" {
+		name, err := regexp.Compile("^(?:" + cfg.Name + ")$")
+		if err != nil {
+			return m, fmt.Errorf("invalid name pattern: %v", err)
+		}
+		m.name = name
+	}
+	if m.deviceType == "" && m.name == nil && m.modelID == "" && m.manufacturer == "" && m.uniqueID == "" {
+		return m, fmt.Errorf("nothing to match on")
+	}
+	return m, nil
+}
+
+func (m deviceMatcher) matches(deviceType string, name string, modelID string, manufacturer string, uniqueID string) bool {
+	return (m.deviceType == "" || m.deviceType == deviceType) &&
+		(m.name == nil || m.name.MatchString(name)) &&
+		(m.modelID == "" || m.modelID == modelID) &&
+		(m.manufacturer == "" || m.manufacturer == manufacturer) &&
+		(m.uniqueID == "" || m.uniqueID == uniqueID)
+}
+
+// deviceFilter keeps the devices that match any of its include rules, or all of them if it has none, unless
+// they match any of its exclude rules
+type deviceFilter struct {
+	include []deviceMatcher
+	exclude []deviceMatcher
+}
+
+func newDeviceFilter(cfg DeviceFilterConfig) (deviceFilter, error) {
+	f := deviceFilter{}
+	for i, match := range cfg.Include {
+		m, err := newDeviceMatcher(match)
+		if err != nil {
+			return f, fmt.Errorf("include %d: %v", i+1, err)
+		}
+		f.include = append(f.include, m)
+	}
+	for i, match := range cfg.Exclude {
+		m, err := newDeviceMatcher(match)
+		if err != nil {
+			return f, fmt.Errorf("exclude %d: %v", i+1, err)
+		}
+		f.exclude = append(f.exclude, m)
+	}
+	return f, nil
+}
+
+func (f deviceFilter) keep(deviceType string, name string, modelID string, manufacturer string, uniqueID string) bool {
+	included := len(f.include) == 0
+	for _, m := range f.include {
+		if m.matches(deviceType, name, modelID, manufacturer, uniqueID) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, m := range f.exclude {
+		if m.matches(deviceType, name, modelID, manufacturer, uniqueID) {
+			return false
+		}
+	}
+	return true
+}
+
+// deviceFilters decides which lights, groups and sensors of a bridge are exported. Groups only have a type
+// and a name to match on.
+type deviceFilters struct {
+	lights  deviceFilter
+	groups  deviceFilter
+	sensors deviceFilter
+}
+
+func newDeviceFilters(cfg FilterConfig) (deviceFilters, error) {
+	var filters deviceFilters
+	var err error
+	if filters.lights, err = newDeviceFilter(cfg.Lights); err != nil {
+		return filters, fmt.Errorf("invalid light filter: %v", err)
+	}
+	if filters.groups, err = newDeviceFilter(cfg.Groups); err != nil {
+		return filters, fmt.Errorf("invalid group filter: %v", err)
+	}
+	if filters.sensors, err = newDeviceFilter(cfg.Sensors); err != nil {
+		return filters, fmt.Errorf("invalid sensor filter: %v", err)
+	}
+	return filters, nil
+}
+
+func (f deviceFilters) filterLights(lights []hue.Light) []hue.Light {
+	kept := []hue.Light{}
+	for _, light := range lights {
+		if f.lights.keep(light.Type, light.Name, light.ModelID, light.ManufacturerName, light.UniqueID) {
+			kept = append(kept, light)
+		}
+	}
+	return kept
+}
+
+func (f deviceFilters) filterGroups(groups []hue.Group) []hue.Group {
+	kept := []hue.Group{}
+	for _, group := range groups {
+		if f.groups.keep(group.Type, group.Name, "", "", "") {
+			kept = append(kept, group)
+		}
+	}
+	return kept
+}
+
+func (f deviceFilters) filterSensors(sensors []hue.Sensor) []hue.Sensor {
+	kept := []hue.Sensor{}
+	for _, sensor := range sensors {
+		if f.sensors.keep(sensor.Type, sensor.Name, sensor.ModelID, sensor.ManufacturerName, sensor.UniqueID) {
+			kept = append(kept, sensor)
+		}
+	}
+	return kept
+}
+
+// apply returns a copy of a datastore with only the lights, groups and sensors that are kept
+func (f deviceFilters) apply(d *datastore.Datastore) *datastore.Datastore {
+	filtered := *d
+	filtered.Lights = f.filterLights(d.Lights)
+	filtered.Groups = f.filterGroups(d.Groups)
+	filtered.Sensors = f.filterSensors(d.Sensors)
+	return &filtered
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/mitchellrj/hue_exporter/test"
+)
+
+func TestDeviceFilter(t *testing.T) {
+	filter, err := newDeviceFilter(DeviceFilterConfig{
+		Include: []DeviceMatchConfig{{Manufacturer: "Signify Netherlands B.V."}, {Name: "Hall.*"}},
+		Exclude: []DeviceMatchConfig{{ModelID: "LCT001", Name: ".*lamp"}, {UniqueID: "00:17:88:01:00:bd:c7:b9-0b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name, modelID, manufacturer, uniqueID string
+		expected                              bool
+	}{
+		{"Reading lamp", "LCT007", "Signify Netherlands B.V.", "1", true},
+		{"Reading lamp", "LCT001", "Signify Netherlands B.V.", "2", false},
+		{"Ceiling", "LCT001", "Signify Netherlands B.V.", "3", true},
+		{"Hallway", "TRADFRI", "IKEA of Sweden", "4", true},
+		{"Kitchen", "TRADFRI", "IKEA of Sweden", "5", false},
+		{"Hallway", "LCT007", "Signify Netherlands B.V.", "00:17:88:01:00:bd:c7:b9-0b", false},
+	} {
+		if actual := filter.keep("Extended color light", c.name, c.modelID, c.manufacturer, c.uniqueID); actual != c.expected {
+			t.Errorf("Expected %v for %+v, got %v", c.expected, c, actual)
+		}
+	}
+}
+
+func TestDeviceFiltersInvalid(t *testing.T) {
+	for _, cfg := range []FilterConfig{
+		{Lights: DeviceFilterConfig{Include: []DeviceMatchConfig{{}}}},
+		{Sensors: DeviceFilterConfig{Exclude: []DeviceMatchConfig{{Name: "("}}}},
+	} {
+		if _, err := newDeviceFilters(cfg); err == nil {
+			t.Errorf("Expected an error from %+v", cfg)
+		}
+	}
+}
+
+func TestSnapshotBridgeFilters(t *testing.T) {
+	stub := test.NewStubBridge().
+		WithLights([]hue.Light{{Name: "Hallway"}, {Name: "Porch"}}).
+		WithGroups([]hue.Group{{Name: "Living room", Type: "Room"}, {Name: "TV area", Type: "Entertainment"}}).
+		WithSensors([]hue.Sensor{{Name: "Hall sensor", Type: "ZLLPresence"}, {Name: "Dimmer status", Type: "CLIPGenericStatus"}})
+	filters, err := newDeviceFilters(FilterConfig{
+		Lights:  DeviceFilterConfig{Exclude: []DeviceMatchConfig{{Name: "Porch"}}},
+		Groups:  DeviceFilterConfig{Exclude: []DeviceMatchConfig{{Type: "Entertainment"}}},
+		Sensors: DeviceFilterConfig{Include: []DeviceMatchConfig{{Type: "ZLLPresence"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := newSnapshotBridge("test_hue", stub, "test", time.Minute)
+	snapshot.filter(filters)
+	var observed *datastore.Datastore
+	snapshot.observe(func(d *datastore.Datastore) {
+		observed = d
+	})
+
+	lights, _ := snapshot.GetAllLights()
+	groups, _ := snapshot.GetAllGroups()
+	sensors, _ := snapshot.GetAllSensors()
+	if len(lights) != 1 || lights[0].Name != "Hallway" {
+		t.Errorf("Expected only the hallway light, got %v", lights)
+	}
+	if len(groups) != 1 || groups[0].Name != "Living room" {
+		t.Errorf("Expected only the living room group, got %v", groups)
+	}
+	if len(sensors) != 1 || sensors[0].Name != "Hall sensor" {
+		t.Errorf("Expected only the hall sensor, got %v", sensors)
+	}
+	if observed == nil || len(observed.Lights) != 1 || len(observed.Groups) != 1 || len(observed.Sensors) != 1 {
+		t.Errorf("Expected observers to see the filtered snapshot, got %+v", observed)
+	}
+}
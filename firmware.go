@@ -0,0 +1,206 @@
+package main
+
+import (
+	"sync"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/prometheus/common/log"
+)
+
+// deviceUpdateStates are the states of a light or sensor's software update process, one of which is always
+// reported
+var deviceUpdateStates = []string{
+	"noupdates",
+	"transferring",
+	"readytoinstall",
+	"installing",
+}
+
+// firmwareCollector exports the software update state of every light and sensor, and counts the changes of
+// software version it sees in every snapshot of the bridge
+type firmwareCollector struct {
+	bridge Bridge
+
+	mutex sync.Mutex
+	// versions is the software version of each light and sensor, by its unique ID
+	versions map[string]string
+
+	lightUpdateState      *prometheus.GaugeVec
+	lightLastInstall      *prometheus.GaugeVec
+	lightFirmwareChanges  *prometheus.CounterVec
+	sensorUpdateState     *prometheus.GaugeVec
+	sensorLastInstall     *prometheus.GaugeVec
+	sensorFirmwareChanges *prometheus.CounterVec
+	firmwareScrapesFailed prometheus.Counter
+}
+
+func newFirmwareCollector(namespace string, bridge Bridge, bridgeName string) *firmwareCollector {
+	return &firmwareCollector{
+		bridge:   bridge,
+		versions: make(map[string]string),
+
+		lightUpdateState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "software_update_state",
+				Help:        "State of the light's software update process (1 for the current state)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			append(labelNames(variableLightLabelNames), "state"),
+		),
+		lightLastInstall: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "software_update_last_install_timestamp_seconds",
+				Help:        "Time the light's software was last updated (Unix epoch)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableLightLabelNames),
+		),
+		lightFirmwareChanges: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "firmware_changes_total",
+				Help:        "Count of changes of the light's software version seen while the exporter has been running",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableLightLabelNames),
+		),
+
+		sensorUpdateState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "software_update_state",
+				Help:        "State of the sensor's software update process (1 for the current state)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			append(labelNames(variableSensorLabelNames), "state"),
+		),
+		sensorLastInstall: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "software_update_last_install_timestamp_seconds",
+				Help:        "Time the sensor's software was last updated (Unix epoch)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorFirmwareChanges: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "firmware_changes_total",
+				Help:        "Count of changes of the sensor's software version seen while the exporter has been running",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		firmwareScrapesFailed: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "firmware",
+				Name:        "scrapes_failed",
+				Help:        "Count of scrapes of firmware data from the Hue bridge that have failed",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+	}
+}
+
+// observe counts the lights and sensors whose software version has changed since the previous snapshot
+func (c *firmwareCollector) observe(d *datastore.Datastore) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, light := range d.Lights {
+		if c.versionChanged(light.UniqueID, light.SWVersion) {
+			c.lightFirmwareChanges.With(labelsForLight(light, d.IDs)).Inc()
+		}
+	}
+	for _, sensor := range d.Sensors {
+		if c.versionChanged(sensor.UniqueID, sensor.SWVersion) {
+			c.sensorFirmwareChanges.With(labelsForSensor(sensor, d.IDs)).Inc()
+		}
+	}
+}
+
+// versionChanged records the software version of a device, and reports whether it was seen before with a
+// different version. The caller must hold mutex.
+func (c *firmwareCollector) versionChanged(uniqueID string, version string) bool {
+	if version == "" {
+		return false
+	}
+	previous, seen := c.versions[uniqueID]
+	c.versions[uniqueID] = version
+	return seen && previous != version
+}
+
+func (c *firmwareCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.lightUpdateState.Describe(ch)
+	c.lightLastInstall.Describe(ch)
+	c.lightFirmwareChanges.Describe(ch)
+	c.sensorUpdateState.Describe(ch)
+	c.sensorLastInstall.Describe(ch)
+	c.sensorFirmwareChanges.Describe(ch)
+	c.firmwareScrapesFailed.Describe(ch)
+}
+
+func (c *firmwareCollector) Collect(ch chan<- prometheus.Metric) {
+	c.lightUpdateState.Reset()
+	c.lightLastInstall.Reset()
+	c.sensorUpdateState.Reset()
+	c.sensorLastInstall.Reset()
+
+	d, err := c.bridge.GetDatastore()
+	if err != nil {
+		log.Errorf("Failed to update firmware: %v", err)
+		c.firmwareScrapesFailed.Inc()
+	} else {
+		for _, light := range d.Lights {
+			c.recordLight(light, d)
+		}
+		for _, sensor := range d.Sensors {
+			c.recordSensor(sensor, d.IDs)
+		}
+	}
+
+	c.lightUpdateState.Collect(ch)
+	c.lightLastInstall.Collect(ch)
+	c.lightFirmwareChanges.Collect(ch)
+	c.sensorUpdateState.Collect(ch)
+	c.sensorLastInstall.Collect(ch)
+	c.sensorFirmwareChanges.Collect(ch)
+	c.firmwareScrapesFailed.Collect(ch)
+}
+
+func (c *firmwareCollector) recordLight(light hue.Light, d *datastore.Datastore) {
+	labels := labelsForLight(light, d.IDs)
+	update, ok := d.LightUpdates[light.UniqueID]
+	if !ok {
+		return
+	}
+	setStateSet(c.lightUpdateState, labels, "state", deviceUpdateStates, update.State)
+	lastInstall, err := datastore.ParseTime(update.LastInstall)
+	if err != nil {
+		log.Errorf("Failed to parse last install time of light %v: %v", light.Name, err)
+	} else if !lastInstall.IsZero() {
+		c.lightLastInstall.With(labels).Set(float64(lastInstall.Unix()))
+	}
+}
+
+func (c *firmwareCollector) recordSensor(sensor hue.Sensor, ids datastore.IDs) {
+	if sensor.SwUpdate.State == "" {
+		return
+	}
+	labels := labelsForSensor(sensor, ids)
+	setStateSet(c.sensorUpdateState, labels, "state", deviceUpdateStates, sensor.SwUpdate.State)
+	if lastInstall := sensor.SwUpdate.LastInstall.Time; lastInstall != nil && !lastInstall.IsZero() {
+		c.sensorLastInstall.With(labels).Set(float64(lastInstall.Unix()))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/mitchellrj/hue_exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestFirmwareCollector(t *testing.T) {
+	light := hue.Light{Name: "Hallway", Type: "Extended color light", UniqueID: "00:17:88:01:03:aa:bb:cc-0b", SWVersion: "1.46.13_r26312"}
+	sensor := hue.Sensor{Name: "Hallway sensor", Type: "ZLLPresence", UniqueID: "00:17:88:01:02:01:64:d1-02-0406", SWVersion: "6.1.1.27575"}
+	sensor.SwUpdate.State = "transferring"
+	lastInstall := time.Date(2019, 3, 11, 10, 22, 35, 0, time.UTC)
+	sensor.SwUpdate.LastInstall = hue.UpdateTime{Time: &lastInstall}
+	bridge := test.NewStubBridge().
+		WithLights([]hue.Light{light}).
+		WithSensors([]hue.Sensor{sensor}).
+		WithLightUpdates(map[string]datastore.SoftwareUpdate{
+			light.UniqueID: {State: "readytoinstall", LastInstall: "2019-03-11T10:22:35"},
+		})
+
+	collector := newFirmwareCollector("test_hue", bridge, "test")
+	metrics := make(chan prometheus.Metric, 50)
+	collector.Collect(metrics)
+	close(metrics)
+
+	with := func(labels prometheus.Labels, name string, value string) prometheus.Labels {
+		l := prometheus.Labels{name: value}
+		for k, v := range labels {
+			l[k] = v
+		}
+		return l
+	}
+	if actual := gaugeValue(t, collector.lightUpdateState.With(with(labelsForLight(light, datastore.IDs{}), "state", "readytoinstall"))); actual != 1 {
+		t.Errorf("Expected the light's update to be ready to install, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.lightLastInstall.With(labelsForLight(light, datastore.IDs{}))); actual != float64(lastInstall.Unix()) {
+		t.Errorf("Expected the light's last install time, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sensorUpdateState.With(with(labelsForSensor(sensor, datastore.IDs{}), "state", "transferring"))); actual != 1 {
+		t.Errorf("Expected the sensor's update to be transferring, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sensorLastInstall.With(labelsForSensor(sensor, datastore.IDs{}))); actual != float64(lastInstall.Unix()) {
+		t.Errorf("Expected the sensor's last install time, got %v", actual)
+	}
+}
+
+func TestFirmwareCollectorCountsChanges(t *testing.T) {
+	collector := newFirmwareCollector("test_hue", test.NewStubBridge(), "test")
+	light := hue.Light{Name: "Hallway", UniqueID: "00:17:88:01:03:aa:bb:cc-0b", SWVersion: "1.46.13_r26312"}
+
+	collector.observe(&datastore.Datastore{Lights: []hue.Light{light}})
+	collector.observe(&datastore.Datastore{Lights: []hue.Light{light}})
+	light.SWVersion = "1.50.2_r30933"
+	collector.observe(&datastore.Datastore{Lights: []hue.Light{light}})
+
+	if actual := counterValue(t, collector.lightFirmwareChanges.With(labelsForLight(light, datastore.IDs{}))); actual != 1 {
+		t.Errorf("Expected 1 firmware change, got %v", actual)
+	}
+}
@@ -20,27 +20,31 @@ func generateConfig(outputFile *string) {
 	} else if len(bridges) == 1 {
 		fmt.Printf("Found 1 Hue bridge on the local network: %s (%v).\n", bridges[0].Info.Device.FriendlyName, bridges[0].IPAddress)
 	} else {
-		panic("Found multiple Hue bridges on the local network.\n")
+		fmt.Printf("Found %d Hue bridges on the local network.\n", len(bridges))
 	}
 
-	bridge := bridges[0]
-	var apiKey string
-
-	for {
-		apiKey, err = bridge.CreateUser("hue_exporter")
-		if err != nil {
-			print("Creating API key failed. Have you pushed the link button on your hub?\nPress Enter to continue.")
-			bufio.NewReader(os.Stdin).ReadBytes('\n')
-		} else {
-			break
+	var cfg Config
+	for _, bridge := range bridges {
+		var apiKey string
+
+		for {
+			apiKey, err = bridge.CreateUser("hue_exporter")
+			if err != nil {
+				fmt.Printf("Creating API key for the bridge at %v failed. Have you pushed the link button on your hub?\nPress Enter to continue.", bridge.IPAddress)
+				bufio.NewReader(os.Stdin).ReadBytes('\n')
+			} else {
+				break
+			}
 		}
+		fmt.Printf("Successfully created API user on the bridge at %v.\n", bridge.IPAddress)
+
+		cfg.Bridges = append(cfg.Bridges, BridgeConfig{
+			IPAddr: bridge.IPAddress,
+			APIKey: apiKey,
+		})
 	}
-	println("Successfully created API user.")
 
-	config, err := yaml.Marshal(Config{
-		IPAddr: bridge.IPAddress,
-		APIKey: apiKey,
-	})
+	config, err := yaml.Marshal(cfg)
 
 	if err != nil {
 		panic(fmt.Sprintf("Error while generating configuration file content: %v.\n", err))
@@ -1,6 +1,8 @@
 package main
 
 import (
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/prometheus/common/log"
 )
@@ -11,60 +13,185 @@ type groupCollector struct {
 	groupHue           *prometheus.GaugeVec
 	groupSaturation    *prometheus.GaugeVec
 	groupOn            *prometheus.GaugeVec
+	groupLights        *prometheus.GaugeVec
+	groupLightsOn      *prometheus.GaugeVec
+	groupReachable     *prometheus.GaugeVec
+	groupLightInfo     *prometheus.GaugeVec
+	groupInfo          *prometheus.GaugeVec
 	groupScrapesFailed prometheus.Counter
+
+	// Aggregates of the state of the lights in the group, rather than of the last action sent to it
+	groupLightsOnCount    *prometheus.GaugeVec
+	groupBrightnessMean   *prometheus.GaugeVec
+	groupBrightnessMin    *prometheus.GaugeVec
+	groupBrightnessMax    *prometheus.GaugeVec
+	groupColorTemperature *prometheus.GaugeVec
 }
 
 var variableGroupLabelNames = []string{
+	"id",
 	"name",
+	"class",
 	"type",
 }
 
+var variableGroupLightLabelNames = []string{
+	"group",
+	"group_id",
+	"light_unique_id",
+}
+
 // NewGroupCollector Create a new Hue collector for groups
-func NewGroupCollector(namespace string, bridge Bridge) prometheus.Collector {
+func NewGroupCollector(namespace string, bridge Bridge, bridgeName string) prometheus.Collector {
 	c := groupCollector{
 		bridge: bridge,
 		groupBrightness: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "group",
-				Name:      "brightness",
-				Help:      "Group brightness level",
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "brightness",
+				Help:        "Group brightness level",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableLightLabelNames,
+			labelNames(variableGroupLabelNames),
 		),
 		groupHue: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "group",
-				Name:      "hue",
-				Help:      "Group hue",
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "hue",
+				Help:        "Group hue",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableLightLabelNames,
+			labelNames(variableGroupLabelNames),
 		),
 		groupSaturation: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "group",
-				Name:      "saturation",
-				Help:      "Group saturation",
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "saturation",
+				Help:        "Group saturation",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableLightLabelNames,
+			labelNames(variableGroupLabelNames),
 		),
 		groupOn: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "group",
-				Name:      "on",
-				Help:      "Group on  (2 = all group members on, 1 = some group members on, 0 = all group members off)",
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "on",
+				Help:        "Group on  (2 = all group members on, 1 = some group members on, 0 = all group members off)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupLights: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "lights",
+				Help:        "Number of lights in the group",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupLightsOn: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "lights_on_ratio",
+				Help:        "Fraction of the lights in the group that are on",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupReachable: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "lights_reachable_ratio",
+				Help:        "Fraction of the lights in the group that are reachable",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupLightInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "light_info",
+				Help:        "Membership of a light in the group",
+				ConstLabels: constLabels(bridgeName),
+			},
+			omitNameLabelNames(variableGroupLightLabelNames, "group"),
+		),
+		groupLightsOnCount: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "lights_on",
+				Help:        "Number of lights in the group that are on",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupBrightnessMean: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "light_brightness_mean",
+				Help:        "Mean brightness level of the lights in the group that are on",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupBrightnessMin: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "light_brightness_min",
+				Help:        "Lowest brightness level of the lights in the group that are on",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupBrightnessMax: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "light_brightness_max",
+				Help:        "Highest brightness level of the lights in the group that are on",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupColorTemperature: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "light_color_temperature_kelvin",
+				Help:        "Colour temperature of most of the light from the lights in the group that are on",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "info",
+				Help:        "Name of the group",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableLightLabelNames,
+			infoLabelNames(variableGroupLabelNames),
 		),
 		groupScrapesFailed: prometheus.NewCounter(
 			prometheus.CounterOpts{
-				Namespace: namespace,
-				Subsystem: "group",
-				Name:      "scrapes_failed",
-				Help:      "Count of scrapes of group data from the Hue bridge that have failed",
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "scrapes_failed",
+				Help:        "Count of scrapes of group data from the Hue bridge that have failed",
+				ConstLabels: constLabels(bridgeName),
 			},
 		),
 	}
@@ -77,30 +204,60 @@ func (c groupCollector) Describe(ch chan<- *prometheus.Desc) {
 	c.groupBrightness.Describe(ch)
 	c.groupHue.Describe(ch)
 	c.groupSaturation.Describe(ch)
+	c.groupLights.Describe(ch)
+	c.groupLightsOn.Describe(ch)
+	c.groupReachable.Describe(ch)
+	c.groupLightInfo.Describe(ch)
+	c.groupInfo.Describe(ch)
+	c.groupLightsOnCount.Describe(ch)
+	c.groupBrightnessMean.Describe(ch)
+	c.groupBrightnessMin.Describe(ch)
+	c.groupBrightnessMax.Describe(ch)
+	c.groupColorTemperature.Describe(ch)
 	c.groupScrapesFailed.Describe(ch)
 }
 
+func labelsForGroup(group hue.Group, ids datastore.IDs) prometheus.Labels {
+	return deviceLabels(prometheus.Labels{
+		"id":    ids.Group(group),
+		"name":  group.Name,
+		"class": group.Class,
+		"type":  group.Type,
+	})
+}
+
 func (c groupCollector) Collect(ch chan<- prometheus.Metric) {
 	c.groupOn.Reset()
 	c.groupBrightness.Reset()
 	c.groupHue.Reset()
 	c.groupSaturation.Reset()
+	c.groupLights.Reset()
+	c.groupLightsOn.Reset()
+	c.groupReachable.Reset()
+	c.groupLightInfo.Reset()
+	c.groupInfo.Reset()
+	c.groupLightsOnCount.Reset()
+	c.groupBrightnessMean.Reset()
+	c.groupBrightnessMin.Reset()
+	c.groupBrightnessMax.Reset()
+	c.groupColorTemperature.Reset()
 
-	groups, err := c.bridge.GetAllGroups()
+	// Groups and their lights come from one datastore, so a failed scrape is only counted once
+	d, err := c.bridge.GetDatastore()
 	if err != nil {
 		log.Errorf("Failed to update groups: %v", err)
 		c.groupScrapesFailed.Inc()
+		d = &datastore.Datastore{}
+	}
+	lights := make(map[string]hue.Light)
+	for _, light := range d.Lights {
+		lights[d.IDs.Light(light)] = light
 	}
 
-	for _, group := range groups {
-		groupLabels := prometheus.Labels{
-			"name":              group.Name,
-			"type":              group.Type,
-			"model_id":          "",
-			"manufacturer_name": "",
-			"product_name":      "",
-			"unique_id":         "",
-		}
+	for _, group := range d.Groups {
+		groupLabels := labelsForGroup(group, d.IDs)
+
+		c.groupInfo.With(infoLabels(groupLabels, group.Name, nil)).Set(1)
 
 		if group.State.AllOn {
 			c.groupOn.With(groupLabels).Set(2)
@@ -112,11 +269,97 @@ func (c groupCollector) Collect(ch chan<- prometheus.Metric) {
 		c.groupBrightness.With(groupLabels).Set(float64(group.Action.Bri))
 		c.groupHue.With(groupLabels).Set(float64(group.Action.Hue))
 		c.groupSaturation.With(groupLabels).Set(float64(group.Action.Sat))
+		c.recordMembers(group, d.IDs.Group(group), groupLabels, lights)
 	}
 
 	c.groupOn.Collect(ch)
 	c.groupBrightness.Collect(ch)
 	c.groupHue.Collect(ch)
 	c.groupSaturation.Collect(ch)
+	c.groupLights.Collect(ch)
+	c.groupLightsOn.Collect(ch)
+	c.groupReachable.Collect(ch)
+	c.groupLightInfo.Collect(ch)
+	c.groupInfo.Collect(ch)
+	c.groupLightsOnCount.Collect(ch)
+	c.groupBrightnessMean.Collect(ch)
+	c.groupBrightnessMin.Collect(ch)
+	c.groupBrightnessMax.Collect(ch)
+	c.groupColorTemperature.Collect(ch)
 	c.groupScrapesFailed.Collect(ch)
 }
+
+// recordMembers records the lights in a group, and the fractions of them that are on and reachable. Lights
+// that the bridge didn't return are left out of the fractions.
+func (c groupCollector) recordMembers(group hue.Group, groupID string, groupLabels prometheus.Labels, lights map[string]hue.Light) {
+	c.groupLights.With(groupLabels).Set(float64(len(group.Lights)))
+
+	var members, on []hue.Light
+	reachable := 0
+	for _, index := range group.Lights {
+		light, ok := lights[index]
+		if !ok {
+			continue
+		}
+		c.groupLightInfo.With(omitNameLabel(prometheus.Labels{
+			"group":           group.Name,
+			"group_id":        groupID,
+			"light_unique_id": light.UniqueID,
+		}, "group")).Set(1)
+		members = append(members, light)
+		if light.State.On && light.State.Reachable {
+			on = append(on, light)
+		}
+		if light.State.Reachable {
+			reachable++
+		}
+	}
+	if len(members) == 0 {
+		return
+	}
+	c.groupLightsOn.With(groupLabels).Set(float64(len(on)) / float64(len(members)))
+	c.groupReachable.With(groupLabels).Set(float64(reachable) / float64(len(members)))
+	c.groupLightsOnCount.With(groupLabels).Set(float64(len(on)))
+	c.recordAggregates(groupLabels, on)
+}
+
+// recordAggregates records the brightness and colour temperature of the lights in a group that are on. Lights
+// that can't be dimmed have no brightness, and are left out. The colour temperature is that of the lights
+// giving the most light in colour temperature mode.
+func (c groupCollector) recordAggregates(groupLabels prometheus.Labels, on []hue.Light) {
+	dimmable, total, lowest, highest := 0, 0, 0, 0
+	// brightnessByCT is the total brightness of the lights at each colour temperature, in mireds
+	brightnessByCT := make(map[int]int)
+	for _, light := range on {
+		bri := int(light.State.Bri)
+		if bri == 0 {
+			continue
+		}
+		if dimmable == 0 || bri < lowest {
+			lowest = bri
+		}
+		if bri > highest {
+			highest = bri
+		}
+		dimmable++
+		total += bri
+		if light.State.ColorMode == "ct" && light.State.CT > 0 {
+			brightnessByCT[light.State.CT] += bri
+		}
+	}
+	if dimmable > 0 {
+		c.groupBrightnessMean.With(groupLabels).Set(float64(total) / float64(dimmable))
+		c.groupBrightnessMin.With(groupLabels).Set(float64(lowest))
+		c.groupBrightnessMax.With(groupLabels).Set(float64(highest))
+	}
+
+	dominant := 0
+	for ct, brightness := range brightnessByCT {
+		if dominant == 0 || brightness > brightnessByCT[dominant] || (brightness == brightnessByCT[dominant] && ct < dominant) {
+			dominant = ct
+		}
+	}
+	if dominant > 0 {
+		c.groupColorTemperature.With(groupLabels).Set(1000000 / float64(dominant))
+	}
+}
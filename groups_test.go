@@ -2,9 +2,12 @@ package main
 
 import (
 	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
 	"github.com/mitchellrj/hue_exporter/test"
 	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestGroupCollector(t *testing.T) {
@@ -27,8 +30,8 @@ func TestGroupCollector(t *testing.T) {
 		},
 	})
 
-	metrics := make(chan prometheus.Metric, 5)
-	collector := NewGroupCollector("test_hue", bridge)
+	metrics := make(chan prometheus.Metric, 10)
+	collector := NewGroupCollector("test_hue", bridge, "test")
 	collector.Collect(metrics)
 	close(metrics)
 
@@ -36,3 +39,105 @@ func TestGroupCollector(t *testing.T) {
 		t.Logf("%v\n", metric)
 	}
 }
+
+func TestGroupCollectorMembers(t *testing.T) {
+	hallway := hue.Light{Index: 1, Name: "Hallway", UniqueID: "00:17:88:01:00:bd:c7:b9-0b"}
+	hallway.State.On = true
+	hallway.State.Reachable = true
+	landing := hue.Light{Index: 2, Name: "Landing", UniqueID: "00:17:88:01:00:bd:c7:ba-0b"}
+	landing.State.Reachable = true
+	porch := hue.Light{Index: 3, Name: "Porch", UniqueID: "00:17:88:01:00:bd:c7:bb-0b"}
+	porch.State.On = true
+	upstairs := hue.Group{Index: 4, Name: "Upstairs", Class: "Upstairs", Type: "Zone", Lights: []string{"1", "2", "3", "5"}}
+	bridge := test.NewStubBridge().
+		WithGroups([]hue.Group{upstairs}).
+		WithLights([]hue.Light{hallway, landing, porch})
+
+	collector := NewGroupCollector("test_hue", bridge, "test").(groupCollector)
+	metrics := make(chan prometheus.Metric, 20)
+	collector.Collect(metrics)
+	close(metrics)
+
+	groupLabels := prometheus.Labels{"id": "4", "name": "Upstairs", "class": "Upstairs", "type": "Zone"}
+	if actual := gaugeValue(t, collector.groupOn.With(groupLabels)); actual != 0 {
+		t.Errorf("Expected the group's state to be off, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.groupLights.With(groupLabels)); actual != 4 {
+		t.Errorf("Expected 4 lights in the group, got %v", actual)
+	}
+	// The light that the bridge didn't return is left out, and the unreachable light is counted as off
+	if actual := gaugeValue(t, collector.groupLightsOn.With(groupLabels)); actual != 1.0/3 {
+		t.Errorf("Expected a third of the lights on, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.groupReachable.With(groupLabels)); actual != 2.0/3 {
+		t.Errorf("Expected two thirds of the lights reachable, got %v", actual)
+	}
+	memberLabels := prometheus.Labels{"group": "Upstairs", "group_id": "4", "light_unique_id": landing.UniqueID}
+	if actual := gaugeValue(t, collector.groupLightInfo.With(memberLabels)); actual != 1 {
+		t.Errorf("Expected the landing light to be in the group, got %v", actual)
+	}
+}
+
+func TestGroupCollectorCountsFailureOnce(t *testing.T) {
+	stub := test.NewStubBridge().WithFailure(test.GetDatastoreFailure)
+	bridge := newSnapshotBridge("test_hue", stub, "test", time.Minute)
+
+	collector := NewGroupCollector("test_hue", bridge, "test").(groupCollector)
+	metrics := make(chan prometheus.Metric, 20)
+	collector.Collect(metrics)
+	close(metrics)
+
+	if actual := counterValue(t, collector.groupScrapesFailed); actual != 1 {
+		t.Errorf("Expected one failed scrape, got %v", actual)
+	}
+}
+
+func TestGroupCollectorAggregates(t *testing.T) {
+	light := func(index int, bri uint8, ct int) hue.Light {
+		l := hue.Light{Index: index, UniqueID: "00:17:88:01:00:bd:c7:b" + strconv.Itoa(index) + "-0b"}
+		l.State.On = true
+		l.State.Reachable = true
+		l.State.Bri = bri
+		l.State.CT = ct
+		l.State.ColorMode = "ct"
+		return l
+	}
+	warm := light(1, 200, 400)
+	cool := light(2, 100, 250)
+	dim := light(3, 50, 250)
+	plug := light(4, 0, 0)
+	off := light(5, 254, 153)
+	off.State.On = false
+	kitchen := hue.Group{Index: 1, Name: "Kitchen", Class: "Kitchen", Type: "Room", Lights: []string{"1", "2", "3", "4", "5"}}
+	kitchen.Action.Bri = 10
+	bridge := test.NewStubBridge().
+		WithGroups([]hue.Group{kitchen}).
+		WithLights([]hue.Light{warm, cool, dim, plug, off})
+
+	collector := NewGroupCollector("test_hue", bridge, "test").(groupCollector)
+	metrics := make(chan prometheus.Metric, 30)
+	collector.Collect(metrics)
+	close(metrics)
+
+	groupLabels := labelsForGroup(kitchen, datastore.IDs{})
+	if actual := gaugeValue(t, collector.groupLightsOnCount.With(groupLabels)); actual != 4 {
+		t.Errorf("Expected 4 lights on, got %v", actual)
+	}
+	// The plug can't be dimmed, so is left out of the brightness
+	if actual := gaugeValue(t, collector.groupBrightnessMean.With(groupLabels)); actual != 350.0/3 {
+		t.Errorf("Expected a mean brightness of 116.67, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.groupBrightnessMin.With(groupLabels)); actual != 50 {
+		t.Errorf("Expected a lowest brightness of 50, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.groupBrightnessMax.With(groupLabels)); actual != 200 {
+		t.Errorf("Expected a highest brightness of 200, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.groupColorTemperature.With(groupLabels)); actual != 2500 {
+		t.Errorf("Expected the warm light to give most of the light, at 2500K, got %v", actual)
+	}
+	// The brightness of the last action sent to the group is still exported
+	if actual := gaugeValue(t, collector.groupBrightness.With(groupLabels)); actual != 10 {
+		t.Errorf("Expected the group's action brightness, got %v", actual)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// deviceLabelRule adds labels to the lights, groups and sensors that it matches
+type deviceLabelRule struct {
+	uniqueID string
+	name     *regexp.Regexp
+	labels   map[string]string
+}
+
+var (
+	// nameInInfo is set when the `name` label of lights, groups and sensors is only on their `*_info` metrics,
+	// so that their other metrics keep the same series when they're renamed
+	nameInInfo bool
+	// staticLabels are added to every metric
+	staticLabels prometheus.Labels
+	// deviceLabelRules add labels to the metrics of the lights, groups and sensors they match, and
+	// deviceLabelNames are the names of all the labels they add, which every one of those metrics has
+	deviceLabelRules []deviceLabelRule
+	deviceLabelNames []string
+)
+
+// configureLabels sets the options for the labels of metrics. It must be called before any collectors are
+// created.
+func configureLabels(cfg LabelConfig) error {
+	reserved := reservedLabelNames()
+	checkName := func(name string) error {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return fmt.Errorf("label name %q starts with %q, which is reserved for Prometheus' own use", name, model.ReservedLabelPrefix)
+		}
+		if reserved[name] {
+			return fmt.Errorf("label %q is already used by the exporter", name)
+		}
+		return nil
+	}
+
+	static := prometheus.Labels{}
+	for name, value := range cfg.Static {
+		if err := checkName(name); err != nil {
+			return err
+		}
+		static[name] = value
+	}
+
+	rules := []deviceLabelRule{}
+	names := make(map[string]bool)
+	for i, device := range cfg.Devices {
+		rule := deviceLabelRule{uniqueID: device.UniqueID, labels: device.Labels}
+		if device.Name != "" {
+			name, err := regexp.Compile("^(?:" + device.Name + ")$")
+			if err != nil {
+				return fmt.Errorf("invalid name pattern for device labels %d: %v", i+1, err)
+			}
+			rule.name = name
+		}
+		if rule.uniqueID == "" && rule.name == nil {
+			return fmt.Errorf("device labels %d have neither a unique_id nor a name to match", i+1)
+		}
+		for name := range device.Labels {
+			if err := checkName(name); err != nil {
+				return err
+			}
+			if _, ok := static[name]; ok {
+				return fmt.Errorf("label %q is both a static and a device label", name)
+			}
+			names[name] = true
+		}
+		rules = append(rules, rule)
+	}
+
+	nameInInfo = cfg.NameInInfo
+	staticLabels = static
+	deviceLabelRules = rules
+	deviceLabelNames = make([]string, 0, len(names))
+	for name := range names {
+		deviceLabelNames = append(deviceLabelNames, name)
+	}
+	sort.Strings(deviceLabelNames)
+	return nil
+}
+
+// reservedLabelNames returns the names of every label of the exporter's own metrics, which configured labels
+// can't use
+func reservedLabelNames() map[string]bool {
+	reserved := map[string]bool{"bridge": true}
+	for _, names := range [][]string{
+		variableLightLabelNames,
+		variableGroupLabelNames,
+		variableGroupLightLabelNames,
+		variableSensorLabelNames,
+		bridgeInfoLabelNames,
+		variableCapabilityLabelNames,
+		sceneInfoLabelNames,
+		scheduleInfoLabelNames,
+		ruleInfoLabelNames,
+		buttonEventLabelNames,
+		motionEventLabelNames,
+		// The labels of single metrics
+		{"mode", "effect", "alert", "state", "to", "button", "action", "swversion", "service"},
+	} {
+		for _, name := range names {
+			reserved[name] = true
+		}
+	}
+	return reserved
+}
+
+// constLabels returns the labels that every metric from a bridge has
+func constLabels(bridgeName string) prometheus.Labels {
+	labels := prometheus.Labels{"bridge": bridgeName}
+	for name, value := range staticLabels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// labelNames returns the names of the labels of a light, group or sensor metric, from the full set of the
+// labels of that kind of device
+func labelNames(names []string) []string {
+	result := make([]string, 0, len(names)+len(deviceLabelNames))
+	for _, name := range names {
+		if name == "name" && nameInInfo {
+			continue
+		}
+		result = append(result, name)
+	}
+	return append(result, deviceLabelNames...)
+}
+
+// omitNameLabelNames returns the names of the labels of a metric that has the name of a light, group or
+// sensor in nameLabel, leaving it out when names are only on the `*_info` metrics
+func omitNameLabelNames(names []string, nameLabel string) []string {
+	if !nameInInfo {
+		return names
+	}
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != nameLabel {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// omitNameLabel removes nameLabel, which holds the name of a light, group or sensor, from the labels of a
+// metric when names are only on the `*_info` metrics
+func omitNameLabel(labels prometheus.Labels, nameLabel string) prometheus.Labels {
+	if nameInInfo {
+		delete(labels, nameLabel)
+	}
+	return labels
+}
+
+// infoLabelNames returns the names of the labels of a light, group or sensor `*_info` metric, which always
+// has the `name` label, along with any others specific to the metric
+func infoLabelNames(names []string, extra ...string) []string {
+	result := labelNames(names)
+	if nameInInfo {
+		result = append(result, "name")
+	}
+	return append(result, extra...)
+}
+
+// deviceLabels returns the labels of a light, group or sensor metric, from the full set of its labels. The
+// labels of every device label rule that matches its unique ID or name are added, with later rules taking
+// precedence.
+func deviceLabels(labels prometheus.Labels) prometheus.Labels {
+	for _, name := range deviceLabelNames {
+		labels[name] = ""
+	}
+	for _, rule := range deviceLabelRules {
+		if (rule.uniqueID != "" && rule.uniqueID == labels["unique_id"]) || (rule.name != nil && rule.name.MatchString(labels["name"])) {
+			for name, value := range rule.labels {
+				labels[name] = value
+			}
+		}
+	}
+	if nameInInfo {
+		delete(labels, "name")
+	}
+	return labels
+}
+
+// infoLabels returns the labels of a light, group or sensor `*_info` metric
+func infoLabels(labels prometheus.Labels, name string, extra prometheus.Labels) prometheus.Labels {
+	result := prometheus.Labels{"name": name}
+	for k, v := range labels {
+		result[k] = v
+	}
+	for k, v := range extra {
+		result[k] = v
+	}
+	return result
+}
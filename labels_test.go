@@ -0,0 +1,158 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestNameInInfo(t *testing.T) {
+	configureLabels(LabelConfig{NameInInfo: true})
+	defer configureLabels(LabelConfig{})
+
+	lamp := hue.Light{Index: 3, Name: "Reading lamp", Type: "Dimmable light", UniqueID: "00:17:88:01:00:bd:c7:b9-0b", SWVersion: "1.46.13_r26312"}
+	lamp.State.On = true
+	bridge := test.NewStubBridge().WithLights([]hue.Light{lamp})
+
+	collector := NewLightCollector("test_hue", bridge, "test", nil, nil).(lightCollector)
+	metrics := make(chan prometheus.Metric, 50)
+	collector.Collect(metrics)
+	close(metrics)
+
+	labels := prometheus.Labels{"id": "3", "type": "Dimmable light", "model_id": "", "manufacturer_name": "", "product_name": "", "unique_id": lamp.UniqueID}
+	if actual := gaugeValue(t, collector.lightOn.With(labels)); actual != 1 {
+		t.Errorf("Expected the light to be on without a name label, got %v", actual)
+	}
+	labels["name"] = "Reading lamp"
+	labels["swversion"] = "1.46.13_r26312"
+	if actual := gaugeValue(t, collector.lightInfo.With(labels)); actual != 1 {
+		t.Errorf("Expected the light's name on its info, got %v", actual)
+	}
+}
+
+func TestDeviceLabels(t *testing.T) {
+	err := configureLabels(LabelConfig{
+		Static: map[string]string{"site": "home"},
+		Devices: []DeviceLabelConfig{
+			{Name: "Living room.*", Labels: map[string]string{"room": "living room"}},
+			{UniqueID: "00:17:88:01:00:bd:c7:b9-0b", Labels: map[string]string{"room": "study", "circuit": "2"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer configureLabels(LabelConfig{})
+
+	lamp := hue.Light{Index: 3, Name: "Living room lamp", UniqueID: "00:17:88:01:00:bd:c7:b9-0b"}
+	lamp.State.On = true
+	bridge := test.NewStubBridge().
+		WithLights([]hue.Light{lamp}).
+		WithGroups([]hue.Group{{Index: 1, Name: "Living room", Type: "Room", Class: "Living room"}})
+
+	lights := NewLightCollector("test_hue", bridge, "test", nil, nil).(lightCollector)
+	metrics := make(chan prometheus.Metric, 50)
+	lights.Collect(metrics)
+	close(metrics)
+
+	labels := prometheus.Labels{"id": "3", "name": "Living room lamp", "type": "", "model_id": "", "manufacturer_name": "", "product_name": "", "unique_id": lamp.UniqueID, "room": "study", "circuit": "2"}
+	lightOn := lights.lightOn.With(labels)
+	if actual := gaugeValue(t, lightOn); actual != 1 {
+		t.Errorf("Expected the later rule's labels on the light, got %v", actual)
+	}
+	var metric dto.Metric
+	if err := lightOn.Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	site := ""
+	for _, pair := range metric.GetLabel() {
+		if pair.GetName() == "site" {
+			site = pair.GetValue()
+		}
+	}
+	if site != "home" {
+		t.Errorf("Expected the static site label on the light, got %q", site)
+	}
+
+	groups := NewGroupCollector("test_hue", bridge, "test").(groupCollector)
+	metrics = make(chan prometheus.Metric, 50)
+	groups.Collect(metrics)
+	close(metrics)
+
+	labels = prometheus.Labels{"id": "1", "name": "Living room", "class": "Living room", "type": "Room", "room": "living room", "circuit": ""}
+	if actual := gaugeValue(t, groups.groupLights.With(labels)); actual != 0 {
+		t.Errorf("Expected the matching rule's labels on the group, got %v", actual)
+	}
+}
+
+func TestDeviceLabelsInvalid(t *testing.T) {
+	defer configureLabels(LabelConfig{})
+	for _, cfg := range []LabelConfig{
+		{Static: map[string]string{"name": "x"}},
+		{Static: map[string]string{"not-a-label": "x"}},
+		{Static: map[string]string{"__site": "x"}},
+		{Devices: []DeviceLabelConfig{{Name: "Study", Labels: map[string]string{"__room": "study"}}}},
+		{Devices: []DeviceLabelConfig{{Labels: map[string]string{"room": "study"}}}},
+		{Devices: []DeviceLabelConfig{{Name: "(", Labels: map[string]string{"room": "study"}}}},
+		{Static: map[string]string{"room": "x"}, Devices: []DeviceLabelConfig{{Name: "Study", Labels: map[string]string{"room": "study"}}}},
+	} {
+		if err := configureLabels(cfg); err == nil {
+			t.Errorf("Expected an error from %+v", cfg)
+		}
+	}
+}
+
+func TestReservedLabelNames(t *testing.T) {
+	configureLabels(LabelConfig{NameInInfo: true})
+	defer configureLabels(LabelConfig{})
+
+	bridge := newSnapshotBridge("test_hue", test.NewStubBridge(), "test", scrapeSnapshotMaxAge)
+	collectors := append(newCollectors(bridge, "test", &BridgeConfig{}).all(), bridge, newEventCollector("test_hue", nil, "test"))
+	descs := make(chan *prometheus.Desc, 500)
+	for _, collector := range collectors {
+		collector.Describe(descs)
+	}
+	close(descs)
+
+	reserved := reservedLabelNames()
+	variableLabels := regexp.MustCompile(`variableLabels: \[([^\]]*)\]`)
+	for desc := range descs {
+		match := variableLabels.FindStringSubmatch(desc.String())
+		if match == nil {
+			t.Fatalf("Can't find the variable labels of %v", desc)
+		}
+		for _, name := range strings.Fields(match[1]) {
+			if !reserved[name] {
+				t.Errorf("Label %q of %v isn't reserved", name, desc)
+			}
+		}
+	}
+
+	if err := configureLabels(LabelConfig{Static: map[string]string{"group": "x"}}); err == nil {
+		t.Errorf("Expected an error from a static label named after a variable label")
+	}
+}
+
+func TestNameInInfoGroupMembers(t *testing.T) {
+	configureLabels(LabelConfig{NameInInfo: true})
+	defer configureLabels(LabelConfig{})
+
+	hallway := hue.Light{Index: 1, Name: "Hallway", UniqueID: "00:17:88:01:00:bd:c7:b9-0b"}
+	bridge := test.NewStubBridge().
+		WithGroups([]hue.Group{{Index: 4, Name: "Upstairs", Type: "Zone", Lights: []string{"1"}}}).
+		WithLights([]hue.Light{hallway})
+
+	collector := NewGroupCollector("test_hue", bridge, "test").(groupCollector)
+	metrics := make(chan prometheus.Metric, 50)
+	collector.Collect(metrics)
+	close(metrics)
+
+	labels := prometheus.Labels{"group_id": "4", "light_unique_id": hallway.UniqueID}
+	if actual := gaugeValue(t, collector.groupLightInfo.With(labels)); actual != 1 {
+		t.Errorf("Expected the light's membership without the group's name, got %v", actual)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/prometheus/common/log"
 )
@@ -12,10 +14,21 @@ type lightCollector struct {
 	lightSaturation    *prometheus.GaugeVec
 	lightOn            *prometheus.GaugeVec
 	lightReachable     *prometheus.GaugeVec
+	lightColorTemp     *prometheus.GaugeVec
+	lightColorX        *prometheus.GaugeVec
+	lightColorY        *prometheus.GaugeVec
+	lightColorMode     *prometheus.GaugeVec
+	lightEffect        *prometheus.GaugeVec
+	lightAlert         *prometheus.GaugeVec
+	lightPower         *prometheus.GaugeVec
+	lightInfo          *prometheus.GaugeVec
 	lightScrapesFailed prometheus.Counter
+	energy             *energyMeter
+	lights             map[string]LightConfig
 }
 
 var variableLightLabelNames = []string{
+	"id",
 	"name",
 	"type",
 	"model_id",
@@ -24,61 +37,158 @@ var variableLightLabelNames = []string{
 	"unique_id",
 }
 
-// NewLightCollector Create a new Hue collector for lights
-func NewLightCollector(namespace string, bridge Bridge) prometheus.Collector {
+// lightColorModes, lightEffects and lightAlerts are the states of a light that are always reported, as
+// state sets
+var (
+	lightColorModes = []string{"hs", "xy", "ct"}
+	lightEffects    = []string{"none", "colorloop"}
+	lightAlerts     = []string{"none", "select", "lselect"}
+)
+
+// NewLightCollector Create a new Hue collector for lights. The energy used by lights is only counted if
+// energy is set.
+func NewLightCollector(namespace string, bridge Bridge, bridgeName string, lights map[string]LightConfig, energy *energyMeter) prometheus.Collector {
 	c := lightCollector{
 		bridge: bridge,
+		energy: energy,
+		lights: lights,
 		lightBrightness: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "light",
-				Name:      "brightness",
-				Help:      "Light brightness level",
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "brightness",
+				Help:        "Light brightness level",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableLightLabelNames,
+			labelNames(variableLightLabelNames),
 		),
 		lightHue: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "light",
-				Name:      "hue",
-				Help:      "Light hue",
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "hue",
+				Help:        "Light hue",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableLightLabelNames,
+			labelNames(variableLightLabelNames),
 		),
 		lightSaturation: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "light",
-				Name:      "saturation",
-				Help:      "Light saturation",
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "saturation",
+				Help:        "Light saturation",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableLightLabelNames,
+			labelNames(variableLightLabelNames),
 		),
 		lightOn: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "light",
-				Name:      "on",
-				Help:      "Light on (1 = on, 0 = off)",
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "on",
+				Help:        "Light on (1 = on, 0 = off)",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableLightLabelNames,
+			labelNames(variableLightLabelNames),
 		),
 		lightReachable: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "light",
-				Name:      "reachable",
-				Help:      "Light reachability (1/0)",
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "reachable",
+				Help:        "Light reachability (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableLightLabelNames),
+		),
+		lightColorTemp: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "color_temperature_kelvin",
+				Help:        "Light colour temperature",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableLightLabelNames),
+		),
+		lightColorX: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "color_x",
+				Help:        "Light colour x coordinate in the CIE colour space",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableLightLabelNames),
+		),
+		lightColorY: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "color_y",
+				Help:        "Light colour y coordinate in the CIE colour space",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableLightLabelNames,
+			labelNames(variableLightLabelNames),
+		),
+		lightColorMode: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "color_mode",
+				Help:        "Light colour mode (1 for the current mode, 0 for others)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			append(labelNames(variableLightLabelNames), "mode"),
+		),
+		lightEffect: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "effect",
+				Help:        "Light effect (1 for the current effect, 0 for others)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			append(labelNames(variableLightLabelNames), "effect"),
+		),
+		lightAlert: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "alert",
+				Help:        "Light alert (1 for the current alert, 0 for others)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			append(labelNames(variableLightLabelNames), "alert"),
+		),
+		lightPower: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "power_watts",
+				Help:        "Estimated power drawn by the light",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableLightLabelNames),
+		),
+		lightInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "info",
+				Help:        "Name and software version of the light",
+				ConstLabels: constLabels(bridgeName),
+			},
+			infoLabelNames(variableLightLabelNames, "swversion"),
 		),
 		lightScrapesFailed: prometheus.NewCounter(
 			prometheus.CounterOpts{
-				Namespace: namespace,
-				Subsystem: "light",
-				Name:      "scrapes_failed",
-				Help:      "Count of scrapes of light data from the Hue bridge that have failed",
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "scrapes_failed",
+				Help:        "Count of scrapes of light data from the Hue bridge that have failed",
+				ConstLabels: constLabels(bridgeName),
 			},
 		),
 	}
@@ -92,7 +202,46 @@ func (c lightCollector) Describe(ch chan<- *prometheus.Desc) {
 	c.lightHue.Describe(ch)
 	c.lightSaturation.Describe(ch)
 	c.lightReachable.Describe(ch)
+	c.lightColorTemp.Describe(ch)
+	c.lightColorX.Describe(ch)
+	c.lightColorY.Describe(ch)
+	c.lightColorMode.Describe(ch)
+	c.lightEffect.Describe(ch)
+	c.lightAlert.Describe(ch)
+	c.lightPower.Describe(ch)
+	c.lightInfo.Describe(ch)
 	c.lightScrapesFailed.Describe(ch)
+	if c.energy != nil {
+		c.energy.energy.Describe(ch)
+	}
+}
+
+// setStateSet sets the gauge for the current state to 1, and for every other known state to 0. The current
+// state is set even if it isn't known.
+func setStateSet(vec *prometheus.GaugeVec, labels prometheus.Labels, labelName string, states []string, current string) {
+	set := func(state string, value float64) {
+		stateLabels := prometheus.Labels{labelName: state}
+		for name, value := range labels {
+			stateLabels[name] = value
+		}
+		vec.With(stateLabels).Set(value)
+	}
+	for _, state := range states {
+		set(state, 0)
+	}
+	set(current, 1)
+}
+
+func labelsForLight(light hue.Light, ids datastore.IDs) prometheus.Labels {
+	return deviceLabels(prometheus.Labels{
+		"id":                ids.Light(light),
+		"name":              light.Name,
+		"type":              light.Type,
+		"model_id":          light.ModelID,
+		"manufacturer_name": light.ManufacturerName,
+		"unique_id":         light.UniqueID,
+		"product_name":      light.ProductName,
+	})
 }
 
 func (c lightCollector) Collect(ch chan<- prometheus.Metric) {
@@ -101,23 +250,26 @@ func (c lightCollector) Collect(ch chan<- prometheus.Metric) {
 	c.lightHue.Reset()
 	c.lightSaturation.Reset()
 	c.lightReachable.Reset()
+	c.lightColorTemp.Reset()
+	c.lightColorX.Reset()
+	c.lightColorY.Reset()
+	c.lightColorMode.Reset()
+	c.lightEffect.Reset()
+	c.lightAlert.Reset()
+	c.lightPower.Reset()
+	c.lightInfo.Reset()
 
-	lights, err := c.bridge.GetAllLights()
+	d, err := c.bridge.GetDatastore()
 	if err != nil {
 		log.Errorf("Failed to update lights: %v", err)
 		c.lightScrapesFailed.Inc()
+		d = &datastore.Datastore{}
 	}
 
-	for _, light := range lights {
-		lightLabels := prometheus.Labels{
-			"name":              light.Name,
-			"type":              light.Type,
-			"model_id":          light.ModelID,
-			"manufacturer_name": light.ManufacturerName,
-			"unique_id":         light.UniqueID,
-			"product_name":      light.ProductName,
-		}
+	for _, light := range d.Lights {
+		lightLabels := labelsForLight(light, d.IDs)
 
+		c.lightInfo.With(infoLabels(lightLabels, light.Name, prometheus.Labels{"swversion": light.SWVersion})).Set(1)
 		if light.State.On {
 			c.lightOn.With(lightLabels).Set(1)
 		} else {
@@ -131,6 +283,28 @@ func (c lightCollector) Collect(ch chan<- prometheus.Metric) {
 		} else {
 			c.lightReachable.With(lightLabels).Set(0)
 		}
+
+		// Lights that only have a brightness report no colour mode, and those that only have a colour
+		// temperature report no xy coordinates
+		if light.State.CT > 0 {
+			c.lightColorTemp.With(lightLabels).Set(1000000 / float64(light.State.CT))
+		}
+		if light.State.ColorMode != "" && light.State.XY != [2]float32{} {
+			c.lightColorX.With(lightLabels).Set(float64(light.State.XY[0]))
+			c.lightColorY.With(lightLabels).Set(float64(light.State.XY[1]))
+		}
+		if light.State.ColorMode != "" {
+			setStateSet(c.lightColorMode, lightLabels, "mode", lightColorModes, light.State.ColorMode)
+		}
+		if light.State.Effect != "" {
+			setStateSet(c.lightEffect, lightLabels, "effect", lightEffects, light.State.Effect)
+		}
+		if light.State.Alert != "" {
+			setStateSet(c.lightAlert, lightLabels, "alert", lightAlerts, light.State.Alert)
+		}
+		if watts, ok := estimatePower(light, c.lights); ok {
+			c.lightPower.With(lightLabels).Set(watts)
+		}
 	}
 
 	c.lightOn.Collect(ch)
@@ -138,5 +312,16 @@ func (c lightCollector) Collect(ch chan<- prometheus.Metric) {
 	c.lightHue.Collect(ch)
 	c.lightSaturation.Collect(ch)
 	c.lightReachable.Collect(ch)
+	c.lightColorTemp.Collect(ch)
+	c.lightColorX.Collect(ch)
+	c.lightColorY.Collect(ch)
+	c.lightColorMode.Collect(ch)
+	c.lightEffect.Collect(ch)
+	c.lightAlert.Collect(ch)
+	c.lightPower.Collect(ch)
+	c.lightInfo.Collect(ch)
 	c.lightScrapesFailed.Collect(ch)
+	if c.energy != nil {
+		c.energy.energy.Collect(ch)
+	}
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLightCollectorColor(t *testing.T) {
+	ambiance := hue.Light{Name: "Desk", Type: "Color temperature light"}
+	ambiance.State.CT = 250
+	ambiance.State.ColorMode = "ct"
+	ambiance.State.Alert = "none"
+	color := hue.Light{Name: "Lamp", Type: "Extended color light"}
+	color.State.CT = 153
+	color.State.XY = [2]float32{0.25, 0.5}
+	color.State.ColorMode = "xy"
+	color.State.Effect = "colorloop"
+	color.State.Alert = "lselect"
+	white := hue.Light{Name: "Hallway", Type: "Dimmable light"}
+	white.State.Alert = "none"
+	bridge := test.NewStubBridge().WithLights([]hue.Light{ambiance, color, white})
+
+	collector := NewLightCollector("test_hue", bridge, "test", nil, nil).(lightCollector)
+	metrics := make(chan prometheus.Metric, 50)
+	collector.Collect(metrics)
+	close(metrics)
+
+	labels := func(light hue.Light, extra ...string) prometheus.Labels {
+		l := prometheus.Labels{"id": "0", "name": light.Name, "type": light.Type, "model_id": "", "manufacturer_name": "", "product_name": "", "unique_id": ""}
+		if len(extra) == 2 {
+			l[extra[0]] = extra[1]
+		}
+		return l
+	}
+	if actual := gaugeValue(t, collector.lightColorTemp.With(labels(ambiance))); actual != 4000 {
+		t.Errorf("Expected a colour temperature of 4000K, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.lightColorX.With(labels(color))); actual != 0.25 {
+		t.Errorf("Expected an x coordinate of 0.25, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.lightColorY.With(labels(color))); actual != 0.5 {
+		t.Errorf("Expected a y coordinate of 0.5, got %v", actual)
+	}
+	for mode, expected := range map[string]float64{"ct": 1, "xy": 0, "hs": 0} {
+		if actual := gaugeValue(t, collector.lightColorMode.With(labels(ambiance, "mode", mode))); actual != expected {
+			t.Errorf("Expected %v for colour mode %v, got %v", expected, mode, actual)
+		}
+	}
+	if actual := gaugeValue(t, collector.lightEffect.With(labels(color, "effect", "colorloop"))); actual != 1 {
+		t.Errorf("Expected the colorloop effect, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.lightAlert.With(labels(color, "alert", "lselect"))); actual != 1 {
+		t.Errorf("Expected the lselect alert, got %v", actual)
+	}
+
+	// Each light has info, on, brightness, hue, saturation and reachable, and an alert state set. Only the
+	// colour lights have a colour temperature and colour mode, and only the full colour light has xy and effects.
+	expected := 3*6 + 3*3 + 2 + 2*3 + 2 + 2 + 1
+	if len(metrics) != expected {
+		t.Errorf("Expected %v metrics, got %v", expected, len(metrics))
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -11,8 +12,9 @@ import (
 	"gopkg.in/yaml.v2"
 
 	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/clipv2"
+	"github.com/mitchellrj/hue_exporter/datastore"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/log"
 	"github.com/prometheus/common/version"
 )
@@ -30,21 +32,152 @@ var (
 	output   = generate.Flag("output.file", "The output file to use.").Short('o').Default("hue_exporter.yml").String()
 )
 
+// Config is the top level exporter configuration. A single bridge may be configured with the top level
+// `ip_address` and `api_key` settings, or any number of bridges may be listed under `bridges`.
 type Config struct {
-	IPAddr       string `yaml:"ip_address"`
-	APIKey       string `yaml:"api_key"`
-	SensorConfig struct {
-		IgnoreTypes []string `yaml:"ignore_types"`
-		MatchNames  bool     `yaml:"match_names"`
-	} `yaml:"sensors"`
+	BridgeConfig `yaml:",inline"`
+	Bridges      []BridgeConfig `yaml:"bridges,omitempty"`
+	Labels       LabelConfig    `yaml:"labels,omitempty"`
+}
+
+// LabelConfig holds the options for the labels of lights, groups and sensors, on every bridge
+type LabelConfig struct {
+	// NameInInfo moves the `name` label onto the `*_info` metrics only, so that renaming a light, group or
+	// sensor doesn't split its other metrics into new series
+	NameInInfo bool `yaml:"name_in_info,omitempty"`
+	// Static labels are added to every metric, e.g. to say which site the bridges are at
+	Static map[string]string `yaml:"static,omitempty"`
+	// Devices add labels to the lights, groups and sensors they match
+	Devices []DeviceLabelConfig `yaml:"devices,omitempty"`
+}
+
+// DeviceLabelConfig adds labels to the light, group or sensor with the given unique ID, or to every one whose
+// name matches the given regular expression
+type DeviceLabelConfig struct {
+	UniqueID string            `yaml:"unique_id,omitempty"`
+	Name     string            `yaml:"name,omitempty"`
+	Labels   map[string]string `yaml:"labels,omitempty"`
+}
+
+// BridgeConfig is the configuration for a single Hue bridge
+type BridgeConfig struct {
+	Name         string        `yaml:"name,omitempty"`
+	IPAddr       string        `yaml:"ip_address,omitempty"`
+	APIKey       string        `yaml:"api_key,omitempty"`
+	APIVersion   int           `yaml:"api_version,omitempty"`
+	CAFile       string        `yaml:"ca_file,omitempty"`
+	EventStream  bool          `yaml:"event_stream,omitempty"`
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+	// LightPollInterval is how often lights are polled to see them being switched on and off between
+	// snapshots. It's defaultLightPollInterval if not set, and zero or negative to not poll them.
+	LightPollInterval *time.Duration `yaml:"light_poll_interval,omitempty"`
+	SensorConfig      SensorConfig   `yaml:"sensors,omitempty"`
+	// Filters decide which lights, groups and sensors are exported
+	Filters FilterConfig `yaml:"filters,omitempty"`
+	// Lights is the configuration of individual lights, by name
+	Lights map[string]LightConfig `yaml:"lights,omitempty"`
+}
+
+// SensorConfig holds the sensor options for a bridge
+type SensorConfig struct {
+	IgnoreTypes []string `yaml:"ignore_types,omitempty"`
+	MatchNames  bool     `yaml:"match_names,omitempty"`
+	// VacancyTimeout is how long the area of a presence sensor is counted as occupied after presence was last
+	// detected. It's defaultVacancyTimeout if not set, and negative to only count the time presence is detected.
+	VacancyTimeout time.Duration `yaml:"vacancy_timeout,omitempty"`
+	// Groups is the name of the group each presence sensor is in, by the sensor's name
+	Groups map[string]string `yaml:"groups,omitempty"`
+	// DisableLegacyValue stops the raw values of sensors being exported as hue_sensor_value, once dashboards
+	// use the metrics in physical units instead
+	DisableLegacyValue bool `yaml:"disable_legacy_value,omitempty"`
+}
+
+// FilterConfig holds the filters of the lights, groups and sensors of a bridge
+type FilterConfig struct {
+	Lights  DeviceFilterConfig `yaml:"lights,omitempty"`
+	Groups  DeviceFilterConfig `yaml:"groups,omitempty"`
+	Sensors DeviceFilterConfig `yaml:"sensors,omitempty"`
+}
+
+// DeviceFilterConfig exports only the devices that match any of the Include rules, or every device if there
+// are none, except those that match any of the Exclude rules
+type DeviceFilterConfig struct {
+	Include []DeviceMatchConfig `yaml:"include,omitempty"`
+	Exclude []DeviceMatchConfig `yaml:"exclude,omitempty"`
+}
+
+// DeviceMatchConfig matches the devices that have all of the fields it sets. Name is a regular expression
+// that must match the whole name.
+type DeviceMatchConfig struct {
+	Type         string `yaml:"type,omitempty"`
+	Name         string `yaml:"name,omitempty"`
+	ModelID      string `yaml:"model_id,omitempty"`
+	Manufacturer string `yaml:"manufacturer,omitempty"`
+	UniqueID     string `yaml:"unique_id,omitempty"`
+}
+
+// LightConfig holds the options for a single light
+type LightConfig struct {
+	// Watts is the power the light draws at full brightness, for models that aren't in the catalogue. For
+	// plugs, it's the power of whatever is plugged in.
+	Watts float64 `yaml:"watts,omitempty"`
+	// StandbyWatts is the power the light draws while it's off
+	StandbyWatts float64 `yaml:"standby_watts,omitempty"`
+}
+
+// AllBridges returns the configuration for every bridge, including one configured at the top level
+func (cfg *Config) AllBridges() []BridgeConfig {
+	bridges := []BridgeConfig{}
+	if cfg.IPAddr != "" {
+		bridges = append(bridges, cfg.BridgeConfig)
+	}
+	return append(bridges, cfg.Bridges...)
 }
 
 // Bridge is an interface for the bridge struct from Collinux/gohue to allow stubbing in tests
 type Bridge interface {
 	Login(string) error
+	GetDatastore() (*datastore.Datastore, error)
 	GetAllSensors() ([]hue.Sensor, error)
 	GetAllLights() ([]hue.Light, error)
 	GetAllGroups() ([]hue.Group, error)
+	GetAllScenes() ([]hue.Scene, error)
+	GetAllSchedules() ([]datastore.Schedule, error)
+	GetAllRules() ([]datastore.Rule, error)
+	GetCapabilities() (datastore.Capabilities, error)
+}
+
+// hueBridge adds the parts of the Hue API that Collinux/gohue doesn't cover to its bridge struct
+type hueBridge struct {
+	*hue.Bridge
+}
+
+// GetDatastore retrieves the full state of the bridge with a single request
+func (b hueBridge) GetDatastore() (*datastore.Datastore, error) {
+	return datastore.Fetch(b.Bridge)
+}
+
+// GetCapabilities retrieves the capacity of the bridge for each kind of resource
+func (b hueBridge) GetCapabilities() (datastore.Capabilities, error) {
+	return datastore.FetchCapabilities(b.Bridge)
+}
+
+// GetAllSchedules retrieves all schedules, including the start times of timers that gohue leaves out
+func (b hueBridge) GetAllSchedules() ([]datastore.Schedule, error) {
+	d, err := b.GetDatastore()
+	if err != nil {
+		return []datastore.Schedule{}, err
+	}
+	return d.Schedules, nil
+}
+
+// GetAllRules retrieves all rules, which gohue doesn't cover
+func (b hueBridge) GetAllRules() ([]datastore.Rule, error) {
+	d, err := b.GetDatastore()
+	if err != nil {
+		return []datastore.Rule{}, err
+	}
+	return d.Rules, nil
 }
 
 func readConfig(raw []byte, cfg *Config) {
@@ -54,34 +187,145 @@ func readConfig(raw []byte, cfg *Config) {
 	}
 }
 
-func newBridge(ipAddr string) Bridge {
-	bridge, err := hue.NewBridge(ipAddr)
-	if err != nil {
-		log.Fatalf("Error connecting to Hue bridge at %v: %v\n", ipAddr, err)
+// newBridge connects to a bridge with the version of the API set in its configuration, and returns it with
+// its name
+func newBridge(bridgeCfg *BridgeConfig) (Bridge, string) {
+	switch (*bridgeCfg).APIVersion {
+	case 0, 1:
+		bridge, err := hue.NewBridge((*bridgeCfg).IPAddr)
+		if err != nil {
+			log.Fatalf("Error connecting to Hue bridge at %v: %v\n", (*bridgeCfg).IPAddr, err)
+		}
+		return hueBridge{bridge}, bridgeName(bridgeCfg, bridge.Info.Device.FriendlyName)
+	case 2:
+		bridge, err := clipv2.NewBridge((*bridgeCfg).IPAddr, (*bridgeCfg).CAFile)
+		if err != nil {
+			log.Fatalf("Error connecting to Hue bridge at %v: %v\n", (*bridgeCfg).IPAddr, err)
+		}
+		if (*bridgeCfg).CAFile == "" {
+			log.Warnf("No ca_file set for the Hue bridge at %v, its certificate won't be verified\n", (*bridgeCfg).IPAddr)
+		}
+		return bridge, bridgeName(bridgeCfg, "")
+	default:
+		log.Fatalf("Unsupported API version %d for Hue bridge at %v\n", (*bridgeCfg).APIVersion, (*bridgeCfg).IPAddr)
+	}
+	return nil, ""
+}
+
+// bridgeName returns the value of the `bridge` label for a bridge: the configured name if there is one,
+// otherwise the friendly name the bridge reports for itself, or failing that its address.
+func bridgeName(bridgeCfg *BridgeConfig, friendlyName string) string {
+	if (*bridgeCfg).Name != "" {
+		return (*bridgeCfg).Name
+	}
+	if friendlyName != "" {
+		return friendlyName
+	}
+	return (*bridgeCfg).IPAddr
+}
+
+// lightPollInterval returns how often the lights of a bridge are polled, or zero if they aren't
+func lightPollInterval(bridgeCfg *BridgeConfig) time.Duration {
+	if (*bridgeCfg).LightPollInterval == nil {
+		return defaultLightPollInterval
+	}
+	if *(*bridgeCfg).LightPollInterval < 0 {
+		return 0
+	}
+	return *(*bridgeCfg).LightPollInterval
+}
+
+// newCollectors creates the enabled collectors for a single bridge. Collectors that keep track of the bridge
+// between scrapes observe every snapshot of it.
+func newCollectors(bridge *snapshotBridge, name string, bridgeCfg *BridgeConfig) namedCollectors {
+	collectors := make(namedCollectors)
+	collectors.add("bridge", NewBridgeCollector(namespace, bridge, name))
+	collectors.add("groups", NewGroupCollector(namespace, bridge, name))
+	collectors.add("scenes", NewSceneCollector(namespace, bridge, name))
+	collectors.add("schedules", NewScheduleCollector(namespace, bridge, name))
+	collectors.add("rules", NewRuleCollector(namespace, bridge, name))
+	collectors.add("capabilities", NewCapabilityCollector(namespace, bridge, name))
+	collectors.add("sensors", NewSensorCollector(namespace, bridge, name, (*bridgeCfg).SensorConfig.IgnoreTypes, (*bridgeCfg).SensorConfig.MatchNames, !(*bridgeCfg).SensorConfig.DisableLegacyValue))
+
+	if collectorEnabled("lights") {
+		energy := newEnergyMeter(namespace, name, (*bridgeCfg).Lights)
+		bridge.observe(energy.observe)
+		bridge.observeLights(energy.observe)
+		collectors.add("lights", NewLightCollector(namespace, bridge, name, (*bridgeCfg).Lights, energy))
+	}
+	if collectorEnabled("state") {
+		states := newStateTracker(namespace, name)
+		bridge.observe(states.observe)
+		bridge.observeLights(states.observeLights)
+		collectors.add("state", states)
+	}
+	if collectorEnabled("switches") {
+		switches := newSwitchTracker(namespace, name)
+		bridge.observe(switches.observe)
+		collectors.add("switches", switches)
 	}
-	return bridge
+	if collectorEnabled("presence") {
+		presence := newPresenceTracker(namespace, name, (*bridgeCfg).SensorConfig.VacancyTimeout, (*bridgeCfg).SensorConfig.Groups)
+		bridge.observe(presence.observe)
+		collectors.add("presence", presence)
+	}
+	if collectorEnabled("firmware") {
+		firmware := newFirmwareCollector(namespace, bridge, name)
+		bridge.observe(firmware.observe)
+		collectors.add("firmware", firmware)
+	}
+	return collectors
 }
 
-func setupPrometheus(bridge Bridge, cfg *Config) {
-	err := bridge.Login((*cfg).APIKey)
+func setupPrometheus(bridge Bridge, name string, bridgeCfg *BridgeConfig) namedCollectors {
+	err := bridge.Login((*bridgeCfg).APIKey)
 	if err != nil {
-		log.Fatalf("Error authenticating with Hue bridge at %v: %v\n", (*cfg).IPAddr, err)
+		log.Fatalf("Error authenticating with Hue bridge at %v: %v\n", (*bridgeCfg).IPAddr, err)
 	}
 
-	prometheus.MustRegister(NewGroupCollector(namespace, bridge))
-	prometheus.MustRegister(NewLightCollector(namespace, bridge))
-	prometheus.MustRegister(NewSensorCollector(namespace, bridge, (*cfg).SensorConfig.IgnoreTypes, (*cfg).SensorConfig.MatchNames))
-	prometheus.MustRegister(version.NewCollector("hue_exporter"))
+	filters, err := newDeviceFilters((*bridgeCfg).Filters)
+	if err != nil {
+		log.Fatalf("Error in filters for Hue bridge at %v: %v\n", (*bridgeCfg).IPAddr, err)
+	}
+	var snapshot *snapshotBridge
+	if (*bridgeCfg).PollInterval > 0 {
+		snapshot = newSnapshotBridge(namespace, bridge, name, 0)
+	} else {
+		snapshot = newSnapshotBridge(namespace, bridge, name, scrapeSnapshotMaxAge)
+	}
+	snapshot.filter(filters)
+	collectors := newCollectors(snapshot, name, bridgeCfg)
+	collectors.add("poll", snapshot)
+	if (*bridgeCfg).PollInterval > 0 {
+		go snapshot.poll((*bridgeCfg).PollInterval)
+	}
+	// Lights are only polled for collectors that follow them, and not at all if those are all disabled
+	if interval := lightPollInterval(bridgeCfg); interval > 0 && len(snapshot.lightObservers) > 0 {
+		go snapshot.pollLights(interval)
+	}
+	if (*bridgeCfg).EventStream && collectorEnabled("events") {
+		v2Bridge, ok := bridge.(*clipv2.Bridge)
+		if !ok {
+			log.Fatalf("The event stream of the Hue bridge at %v is only available with api_version 2\n", (*bridgeCfg).IPAddr)
+		}
+		events := newEventCollector(namespace, v2Bridge, name)
+		go events.run(context.Background())
+		collectors.add("events", events)
+	}
+	prometheus.MustRegister(collectors.all()...)
+	return collectors
 }
 
-func listen() {
-	http.Handle("/metrics", promhttp.Handler())
+func listen(targets map[string]namedCollectors) {
+	http.Handle("/metrics", metricsHandler(targets))
+	http.Handle("/probe", probeHandler(targets))
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
             <head><title>Hue Exporter</title></head>
             <body>
             <h1>Hue Exporter</h1>
             <p><a href="/metrics">Metrics</a></p>
+            <p><a href="/probe?target=">Probe</a> a single bridge by name</p>
             </body>
             </html>`))
 	})
@@ -103,9 +347,25 @@ func runServer() {
 		log.Fatalf("Error reading config file: %v\n", err)
 	}
 	readConfig(raw, &cfg)
-	bridge := newBridge(cfg.IPAddr)
-	setupPrometheus(bridge, &cfg)
-	listen()
+	if err := configureLabels(cfg.Labels); err != nil {
+		log.Fatalf("Error in label config: %v\n", err)
+	}
+
+	bridges := cfg.AllBridges()
+	if len(bridges) == 0 {
+		log.Fatalf("No Hue bridges configured in %v\n", *config)
+	}
+	configureCollectors()
+	targets := make(map[string]namedCollectors)
+	for i := range bridges {
+		bridge, name := newBridge(&bridges[i])
+		if _, ok := targets[name]; ok {
+			log.Fatalf("Duplicate Hue bridge name %q, set a unique `name` for each bridge\n", name)
+		}
+		targets[name] = setupPrometheus(bridge, name, &bridges[i])
+	}
+	prometheus.MustRegister(version.NewCollector("hue_exporter"))
+	listen(targets)
 }
 
 func main() {
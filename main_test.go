@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLightPollInterval(t *testing.T) {
+	cases := []struct {
+		config   string
+		expected time.Duration
+	}{
+		{"ip_address: 192.168.1.2", defaultLightPollInterval},
+		{"ip_address: 192.168.1.2\nlight_poll_interval: 2s", 2 * time.Second},
+		{"ip_address: 192.168.1.2\nlight_poll_interval: 0s", 0},
+		{"ip_address: 192.168.1.2\nlight_poll_interval: -1s", 0},
+	}
+	for _, c := range cases {
+		var cfg Config
+		readConfig([]byte(c.config), &cfg)
+		if actual := lightPollInterval(&cfg.AllBridges()[0]); actual != c.expected {
+			t.Errorf("Expected a light poll interval of %v for %q, got %v", c.expected, c.config, actual)
+		}
+	}
+}
+
+func TestAllBridges(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{"none", "labels:\n  name_in_info: true", []string{}},
+		{"top level", "ip_address: 192.168.1.2\napi_key: abc", []string{"192.168.1.2"}},
+		{"list", "bridges:\n- ip_address: 192.168.1.2\n- ip_address: 192.168.2.2", []string{"192.168.1.2", "192.168.2.2"}},
+		// A bridge at the top level is merged with the list, ahead of it
+		{"both", "ip_address: 192.168.1.2\nbridges:\n- ip_address: 192.168.2.2", []string{"192.168.1.2", "192.168.2.2"}},
+		// Settings at the top level without an address don't make a bridge
+		{"top level without address", "api_key: abc\nbridges:\n- ip_address: 192.168.2.2", []string{"192.168.2.2"}},
+	}
+	for _, c := range cases {
+		var cfg Config
+		readConfig([]byte(c.config), &cfg)
+		bridges := cfg.AllBridges()
+		addresses := make([]string, len(bridges))
+		for i, bridge := range bridges {
+			addresses[i] = bridge.IPAddr
+		}
+		if strings.Join(addresses, ",") != strings.Join(c.expected, ",") {
+			t.Errorf("%s: expected bridges %v, got %v", c.name, c.expected, addresses)
+		}
+	}
+}
+
+func TestBridgeName(t *testing.T) {
+	cases := []struct {
+		name         string
+		bridgeCfg    BridgeConfig
+		friendlyName string
+		expected     string
+	}{
+		{"configured", BridgeConfig{Name: "house", IPAddr: "192.168.1.2"}, "Philips hue", "house"},
+		{"friendly name", BridgeConfig{IPAddr: "192.168.1.2"}, "Philips hue", "Philips hue"},
+		{"address", BridgeConfig{IPAddr: "192.168.1.2"}, "", "192.168.1.2"},
+	}
+	for _, c := range cases {
+		if actual := bridgeName(&c.bridgeCfg, c.friendlyName); actual != c.expected {
+			t.Errorf("%s: expected the bridge to be named %q, got %q", c.name, c.expected, actual)
+		}
+	}
+}
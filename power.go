@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lightPower is the power drawn by a model of light, in watts
+type lightPower struct {
+	watts        float64 // At full brightness, or zero if it isn't known, as for plugs
+	standbyWatts float64
+}
+
+// lightPowerCatalogue is the rated and standby power of Hue lights and plugs, by model ID
+var lightPowerCatalogue = map[string]lightPower{
+	// White and color ambiance bulbs
+	"LCT001": {8.5, 0.4},  // A19
+	"LCT007": {9, 0.4},    // A19
+	"LCT010": {10, 0.4},   // A19
+	"LCT014": {10, 0.4},   // A19
+	"LCT015": {9.5, 0.4},  // A19
+	"LCT016": {9, 0.4},    // A19
+	"LCT002": {8, 0.4},    // BR30
+	"LCT011": {8, 0.4},    // BR30
+	"LCT024": {10, 0.4},   // BR30
+	"LCT003": {6.5, 0.4},  // GU10
+	"LCT012": {6, 0.4},    // E14 candle
+	"LLC010": {10, 0.4},   // Iris
+	"LLC011": {8, 0.4},    // Bloom
+	"LLC012": {8, 0.4},    // Bloom
+	"LLC020": {6, 0.4},    // Go
+	"LST001": {12, 0.5},   // Lightstrip
+	"LST002": {20.5, 0.4}, // Lightstrip plus
+	"LCL001": {20, 0.5},   // Lightstrip outdoor
+	// White ambiance bulbs
+	"LTW001": {9.5, 0.4}, // A19
+	"LTW004": {9.5, 0.4}, // A19
+	"LTW010": {9.5, 0.4}, // A19
+	"LTW015": {9.5, 0.4}, // A19
+	"LTW012": {5.5, 0.4}, // E14 candle
+	"LTW013": {5.5, 0.4}, // GU10
+	"LTW014": {5.5, 0.4}, // GU10
+	// White bulbs
+	"LWB004": {9, 0.4},   // A19
+	"LWB006": {9, 0.4},   // A19
+	"LWB007": {9, 0.4},   // A19
+	"LWB010": {9, 0.3},   // A19
+	"LWB014": {9.5, 0.3}, // A19
+	"LWA001": {9.5, 0.3}, // A19
+	// Plugs, which draw whatever is plugged into them
+	"LOM001": {0, 0.3},
+	"LOM002": {0, 0.3},
+	"LOM004": {0, 0.3},
+}
+
+// powerOf returns the power a light draws, from its configuration if it has any, otherwise from the catalogue
+func powerOf(light hue.Light, lights map[string]LightConfig) (lightPower, bool) {
+	power, ok := lightPowerCatalogue[light.ModelID]
+	if cfg, configured := lights[light.Name]; configured {
+		if cfg.Watts > 0 {
+			power.watts = cfg.Watts
+		}
+		if cfg.StandbyWatts > 0 {
+			power.standbyWatts = cfg.StandbyWatts
+		}
+		ok = true
+	}
+	return power, ok
+}
+
+// estimatePower estimates the power a light is drawing from its state. Unreachable lights are assumed to
+// have been switched off at the wall, so draw nothing. Lights are assumed to draw power in proportion to
+// their brightness, between their standby and full power.
+func estimatePower(light hue.Light, lights map[string]LightConfig) (float64, bool) {
+	power, ok := powerOf(light, lights)
+	switch {
+	case !ok:
+		return 0, false
+	case !light.State.Reachable:
+		return 0, true
+	case !light.State.On:
+		return power.standbyWatts, true
+	case power.watts == 0:
+		return 0, false
+	case light.State.Bri == 0:
+		// Lights that can't be dimmed have no brightness
+		return power.watts, true
+	}
+	return power.standbyWatts + (power.watts-power.standbyWatts)*float64(light.State.Bri)/254, true
+}
+
+// powerReading is the power a light was drawing at a point in time
+type powerReading struct {
+	watts float64
+	time  time.Time
+}
+
+// energyMeter integrates the estimated power of each light over every snapshot of the bridge and every poll
+// of its lights, so that the energy used between scrapes is counted
+type energyMeter struct {
+	lights map[string]LightConfig
+
+	mutex    sync.Mutex
+	readings map[string]powerReading
+	energy   *prometheus.CounterVec
+}
+
+func newEnergyMeter(namespace string, bridgeName string, lights map[string]LightConfig) *energyMeter {
+	return &energyMeter{
+		lights:   lights,
+		readings: make(map[string]powerReading),
+		energy: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "energy_joules_total",
+				Help:        "Estimated energy used by the light",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableLightLabelNames),
+		),
+	}
+}
+
+// observe adds the energy used by each light since it was previously seen, from a snapshot of the bridge or a
+// poll of its lights, assuming that it drew the same power throughout
+func (m *energyMeter) observe(d *datastore.Datastore) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	at := d.Fetched
+	for _, light := range d.Lights {
+		watts, ok := estimatePower(light, m.lights)
+		if !ok {
+			delete(m.readings, light.UniqueID)
+			continue
+		}
+		previous, seen := m.readings[light.UniqueID]
+		if seen && !at.After(previous.time) {
+			continue
+		}
+		if seen {
+			m.energy.With(labelsForLight(light, d.IDs)).Add(previous.watts * at.Sub(previous.time).Seconds())
+		}
+		m.readings[light.UniqueID] = powerReading{watts: watts, time: at}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+)
+
+func TestEstimatePower(t *testing.T) {
+	light := func(model string, name string, on bool, bri uint8, reachable bool) hue.Light {
+		l := hue.Light{ModelID: model, Name: name}
+		l.State.On = on
+		l.State.Bri = bri
+		l.State.Reachable = reachable
+		return l
+	}
+	config := map[string]LightConfig{
+		"Heater":  {Watts: 2000},
+		"Strange": {Watts: 7, StandbyWatts: 0.2},
+	}
+
+	tests := []struct {
+		light hue.Light
+		watts float64
+		ok    bool
+	}{
+		{light("LWB010", "Hallway", true, 254, true), 9, true},
+		{light("LWB010", "Hallway", true, 127, true), 4.65, true},
+		{light("LWB010", "Hallway", false, 254, true), 0.3, true},
+		{light("LWB010", "Hallway", true, 254, false), 0, true},
+		{light("LOM001", "Plug", true, 0, true), 0, false},
+		{light("LOM001", "Plug", false, 0, true), 0.3, true},
+		{light("LOM001", "Heater", true, 0, true), 2000, true},
+		{light("XYZ123", "Strange", true, 254, true), 7, true},
+		{light("XYZ123", "Unknown", true, 254, true), 0, false},
+	}
+	for _, test := range tests {
+		watts, ok := estimatePower(test.light, config)
+		if ok != test.ok || (ok && (watts < test.watts-0.01 || watts > test.watts+0.01)) {
+			t.Errorf("Expected %v (%v) for %+v, got %v (%v)", test.watts, test.ok, test.light, watts, ok)
+		}
+	}
+}
+
+func TestEnergyMeter(t *testing.T) {
+	meter := newEnergyMeter("test_hue", "test", nil)
+	light := hue.Light{ModelID: "LWB010", Name: "Hallway", UniqueID: "00:17:88:01:00:bd:c7:b9-0b"}
+	light.State.Reachable = true
+	start := time.Now()
+
+	light.State.On = true
+	light.State.Bri = 254
+	meter.observe(&datastore.Datastore{Lights: []hue.Light{light}, Fetched: start})
+	light.State.On = false
+	meter.observe(&datastore.Datastore{Lights: []hue.Light{light}, Fetched: start.Add(time.Minute)})
+	meter.observe(&datastore.Datastore{Lights: []hue.Light{light}, Fetched: start.Add(2 * time.Minute)})
+
+	// A minute at 9W, then a minute at 0.3W
+	if actual := counterValue(t, meter.energy.With(labelsForLight(light, datastore.IDs{}))); actual != 9*60+0.3*60 {
+		t.Errorf("Expected %v joules, got %v", 9*60+0.3*60, actual)
+	}
+}
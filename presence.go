@@ -0,0 +1,300 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultVacancyTimeout is how long a place is assumed to still be occupied after presence was last detected
+// there, unless configured otherwise
+const defaultVacancyTimeout = 5 * time.Minute
+
+// occupancy follows the time a place has been occupied, from the presence detected there
+type occupancy struct {
+	observed      time.Time
+	occupiedUntil time.Time
+}
+
+// advance moves the occupancy on to a new observation, returning the number of seconds the place was occupied
+// since the previous one. Presence was detected from start until lastPresent, or not at all if start is zero.
+func (o *occupancy) advance(at time.Time, start time.Time, lastPresent time.Time, timeout time.Duration) float64 {
+	clamp := func(t time.Time) time.Time {
+		if t.Before(o.observed) {
+			return o.observed
+		}
+		if t.After(at) {
+			return at
+		}
+		return t
+	}
+	// The place is occupied until the end of the vacancy timeout from before, and from the start of any
+	// presence since until its own vacancy timeout ends
+	previousEnd := clamp(o.occupiedUntil)
+	seconds := previousEnd.Sub(o.observed).Seconds()
+	if !start.IsZero() {
+		s, e := clamp(start), clamp(lastPresent.Add(timeout))
+		if s.Before(previousEnd) {
+			s = previousEnd
+		}
+		if e.After(s) {
+			seconds += e.Sub(s).Seconds()
+		}
+		if lastPresent.Add(timeout).After(o.occupiedUntil) {
+			o.occupiedUntil = lastPresent.Add(timeout)
+		}
+	}
+	o.observed = at
+	return seconds
+}
+
+// presenceState is what was last seen of a presence sensor
+type presenceState struct {
+	present     bool
+	lastUpdated time.Time
+	occupancy   occupancy
+}
+
+// presenceActivity is the presence a sensor detected between two observations
+type presenceActivity struct {
+	detected    bool
+	start       time.Time
+	lastPresent time.Time
+}
+
+// presenceTracker follows the presence detected by motion sensors in every snapshot of the bridge. The bridge
+// reports when each sensor's presence last changed, so detections between snapshots are counted too, unless
+// presence is detected more than once between two snapshots. Sensors mapped to a group are rolled up into it.
+type presenceTracker struct {
+	timeout time.Duration
+	// groups is the name of the group each sensor is in, by the sensor's name
+	groups map[string]string
+
+	mutex   sync.Mutex
+	sensors map[string]*presenceState
+	rooms   map[string]*occupancy
+
+	detections        *prometheus.CounterVec
+	lastDetected      *prometheus.GaugeVec
+	occupiedSeconds   *prometheus.CounterVec
+	groupDetections   *prometheus.CounterVec
+	groupLastDetected *prometheus.GaugeVec
+	groupOccupied     *prometheus.CounterVec
+}
+
+func newPresenceTracker(namespace string, bridgeName string, timeout time.Duration, groups map[string]string) *presenceTracker {
+	if timeout == 0 {
+		timeout = defaultVacancyTimeout
+	} else if timeout < 0 {
+		timeout = 0
+	}
+	return &presenceTracker{
+		timeout: timeout,
+		groups:  groups,
+		sensors: make(map[string]*presenceState),
+		rooms:   make(map[string]*occupancy),
+		detections: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "presence",
+				Name:        "detections_total",
+				Help:        "Count of times the sensor has started detecting presence while the exporter has been running",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		lastDetected: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "presence",
+				Name:        "last_detected_timestamp_seconds",
+				Help:        "Time the sensor last started detecting presence (Unix epoch)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		occupiedSeconds: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "presence",
+				Name:        "occupied_seconds_total",
+				Help:        "Time the sensor's area has been occupied, until the vacancy timeout after presence was last detected",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		groupDetections: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "presence_detections_total",
+				Help:        "Count of times the sensors in the group have started detecting presence while the exporter has been running",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupLastDetected: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "presence_last_detected_timestamp_seconds",
+				Help:        "Time any sensor in the group last started detecting presence (Unix epoch)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupOccupied: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "presence_occupied_seconds_total",
+				Help:        "Time the group has been occupied, until the vacancy timeout after any of its sensors last detected presence",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+	}
+}
+
+// observe follows the presence sensors in a snapshot of the bridge
+func (p *presenceTracker) observe(d *datastore.Datastore) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	at := d.Fetched
+
+	groups := make(map[string]hue.Group)
+	for _, group := range d.Groups {
+		groups[group.Name] = group
+	}
+	roomActivity := make(map[string]presenceActivity)
+	roomPresent := make(map[string]bool)
+
+	for _, sensor := range d.Sensors {
+		if sensor.Type != "ZLLPresence" {
+			continue
+		}
+		var lastUpdated time.Time
+		if sensor.State.LastUpdated.Time != nil {
+			lastUpdated = *sensor.State.LastUpdated.Time
+		}
+		present := sensor.State.Presence
+		labels := labelsForSensor(sensor, d.IDs)
+		group, inGroup := groups[p.groups[sensor.Name]]
+
+		state, seen := p.sensors[sensor.UniqueID]
+		if !seen {
+			state = &presenceState{occupancy: occupancy{observed: at}}
+			if present {
+				state.occupancy.occupiedUntil = at.Add(p.timeout)
+				p.lastDetected.With(labels).Set(float64(lastUpdated.Unix()))
+			}
+			state.present = present
+			state.lastUpdated = lastUpdated
+			p.sensors[sensor.UniqueID] = state
+			if inGroup {
+				roomPresent[group.Name] = roomPresent[group.Name] || present
+			}
+			continue
+		}
+		if !at.After(state.occupancy.observed) {
+			continue
+		}
+
+		activity := state.activity(present, lastUpdated, at)
+		state.present = present
+		if lastUpdated.After(state.lastUpdated) {
+			state.lastUpdated = lastUpdated
+		}
+		if activity.detected {
+			p.detections.With(labels).Inc()
+			p.lastDetected.With(labels).Set(float64(lastUpdated.Unix()))
+		}
+		p.occupiedSeconds.With(labels).Add(state.occupancy.advance(at, activity.start, activity.lastPresent, p.timeout))
+
+		if inGroup {
+			roomActivity[group.Name] = mergeActivity(roomActivity[group.Name], activity)
+			if activity.detected {
+				p.groupDetections.With(labelsForGroup(group, d.IDs)).Inc()
+				p.groupLastDetected.With(labelsForGroup(group, d.IDs)).Set(float64(lastUpdated.Unix()))
+			}
+		}
+	}
+
+	for name, group := range groups {
+		activity, active := roomActivity[name]
+		present, seen := roomPresent[name]
+		room, ok := p.rooms[name]
+		if !ok {
+			if !active && !seen {
+				continue
+			}
+			room = &occupancy{observed: at}
+			if present {
+				room.occupiedUntil = at.Add(p.timeout)
+			}
+			p.rooms[name] = room
+			continue
+		}
+		if !at.After(room.observed) {
+			continue
+		}
+		p.groupOccupied.With(labelsForGroup(group, d.IDs)).Add(room.advance(at, activity.start, activity.lastPresent, p.timeout))
+	}
+}
+
+// activity works out the presence a sensor has detected since it was last seen. The bridge updates the time of
+// a sensor's state whenever presence is detected or stops being detected.
+func (s *presenceState) activity(present bool, lastUpdated time.Time, at time.Time) presenceActivity {
+	changed := !lastUpdated.IsZero() && lastUpdated.After(s.lastUpdated)
+	switch {
+	case present && changed:
+		return presenceActivity{detected: true, start: lastUpdated, lastPresent: at}
+	case present:
+		return presenceActivity{start: s.occupancy.observed, lastPresent: at}
+	case changed && s.present:
+		return presenceActivity{start: s.occupancy.observed, lastPresent: lastUpdated}
+	case changed:
+		// Presence was detected and stopped between the observations, so it's only known when it stopped
+		return presenceActivity{detected: true, start: lastUpdated, lastPresent: lastUpdated}
+	}
+	return presenceActivity{}
+}
+
+// mergeActivity combines the presence detected by two sensors in the same place
+func mergeActivity(a presenceActivity, b presenceActivity) presenceActivity {
+	if b.start.IsZero() {
+		return a
+	}
+	if a.start.IsZero() {
+		return b
+	}
+	if b.start.Before(a.start) {
+		a.start = b.start
+	}
+	if b.lastPresent.After(a.lastPresent) {
+		a.lastPresent = b.lastPresent
+	}
+	a.detected = a.detected || b.detected
+	return a
+}
+
+func (p *presenceTracker) Describe(ch chan<- *prometheus.Desc) {
+	p.detections.Describe(ch)
+	p.lastDetected.Describe(ch)
+	p.occupiedSeconds.Describe(ch)
+	p.groupDetections.Describe(ch)
+	p.groupLastDetected.Describe(ch)
+	p.groupOccupied.Describe(ch)
+}
+
+func (p *presenceTracker) Collect(ch chan<- prometheus.Metric) {
+	p.detections.Collect(ch)
+	p.lastDetected.Collect(ch)
+	p.occupiedSeconds.Collect(ch)
+	p.groupDetections.Collect(ch)
+	p.groupLastDetected.Collect(ch)
+	p.groupOccupied.Collect(ch)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+)
+
+func TestPresenceTracker(t *testing.T) {
+	tracker := newPresenceTracker("test_hue", "test", time.Minute, map[string]string{"Hallway sensor": "Hallway"})
+	sensor := hue.Sensor{Name: "Hallway sensor", Type: "ZLLPresence", ModelID: "SML001", UniqueID: "00:17:88:01:02:01:64:d1-02-0406"}
+	hallway := hue.Group{Index: 1, Name: "Hallway", Type: "Room"}
+	start := time.Now().Truncate(time.Second)
+	observe := func(present bool, updated time.Time, at time.Time) {
+		sensor.State.Presence = present
+		sensor.State.LastUpdated = hue.UpdateTime{Time: &updated}
+		tracker.observe(&datastore.Datastore{
+			Sensors: []hue.Sensor{sensor},
+			Groups:  []hue.Group{hallway},
+			Fetched: at,
+		})
+	}
+
+	observe(false, start.Add(-time.Hour), start)
+	// Presence detected, then no longer detected, then occupied until the vacancy timeout
+	observe(true, start.Add(20*time.Second), start.Add(30*time.Second))
+	observe(false, start.Add(40*time.Second), start.Add(60*time.Second))
+	observe(false, start.Add(40*time.Second), start.Add(180*time.Second))
+	// Presence detected and no longer detected between two snapshots
+	observe(false, start.Add(250*time.Second), start.Add(300*time.Second))
+
+	labels := labelsForSensor(sensor, datastore.IDs{})
+	if actual := counterValue(t, tracker.detections.With(labels)); actual != 2 {
+		t.Errorf("Expected 2 detections, got %v", actual)
+	}
+	if actual := gaugeValue(t, tracker.lastDetected.With(labels)); actual != float64(start.Add(250*time.Second).Unix()) {
+		t.Errorf("Expected presence last detected when it was last updated, got %v", actual)
+	}
+	if actual := counterValue(t, tracker.occupiedSeconds.With(labels)); actual != 130 {
+		t.Errorf("Expected occupied for 130 seconds, got %v", actual)
+	}
+	if actual := counterValue(t, tracker.groupDetections.With(labelsForGroup(hallway, datastore.IDs{}))); actual != 2 {
+		t.Errorf("Expected 2 detections in the hallway, got %v", actual)
+	}
+	if actual := counterValue(t, tracker.groupOccupied.With(labelsForGroup(hallway, datastore.IDs{}))); actual != 130 {
+		t.Errorf("Expected hallway occupied for 130 seconds, got %v", actual)
+	}
+}
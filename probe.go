@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// probeHandler serves the metrics of a single bridge, named by the `target` query parameter, in the style
+// of the blackbox exporter. Each request gathers from a fresh registry, so Prometheus decides which bridges
+// are scraped and how often, and a bridge that is down only fails its own scrapes. The `collect[]` query
+// parameter picks collectors, as it does for `/metrics`.
+func probeHandler(targets map[string]namedCollectors) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "The target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		collectors, ok := targets[target]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown target %q", target), http.StatusNotFound)
+			return
+		}
+
+		names, err := collectParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		if err := register(registry, collectors.selected(names)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/test"
+)
+
+func TestProbeHandler(t *testing.T) {
+	house := test.NewStubBridge().WithLights([]hue.Light{
+		hue.Light{Name: "Hallway", Type: "Extended color light"},
+	})
+	office := test.NewStubBridge().WithLights([]hue.Light{
+		hue.Light{Name: "Desk", Type: "Extended color light"},
+	})
+	handler := probeHandler(map[string]namedCollectors{
+		"house":  newCollectors(newSnapshotBridge("test_hue", house, "house", scrapeSnapshotMaxAge), "house", &BridgeConfig{}),
+		"office": newCollectors(newSnapshotBridge("test_hue", office, "office", scrapeSnapshotMaxAge), "office", &BridgeConfig{}),
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/probe?target=office", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `bridge="office"`) || !strings.Contains(body, `name="Desk"`) {
+		t.Errorf("Expected metrics for the office bridge, got:\n%s", body)
+	}
+	if strings.Contains(body, `bridge="house"`) {
+		t.Errorf("Expected no metrics for the house bridge, got:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/probe?target=garage", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown target, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/probe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a missing target, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
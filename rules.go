@@ -0,0 +1,230 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/prometheus/common/log"
+)
+
+type ruleCollector struct {
+	bridge               Bridge
+	ruleInfo             *prometheus.GaugeVec
+	ruleEnabled          *prometheus.GaugeVec
+	ruleTimesTriggered   *prometheus.GaugeVec
+	ruleLastTriggered    *prometheus.GaugeVec
+	ruleBrokenReferences *prometheus.GaugeVec
+	ruleScrapesFailed    prometheus.Counter
+}
+
+var variableRuleLabelNames = []string{
+	"name",
+	"rule_id",
+}
+
+var ruleInfoLabelNames = append([]string{"owner", "status"}, variableRuleLabelNames...)
+
+// NewRuleCollector Create a new Hue collector for rules
+func NewRuleCollector(namespace string, bridge Bridge, bridgeName string) prometheus.Collector {
+	c := ruleCollector{
+		bridge: bridge,
+		ruleInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "rule",
+				Name:        "info",
+				Help:        "Rule information (always 1)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			ruleInfoLabelNames,
+		),
+		ruleEnabled: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "rule",
+				Name:        "enabled",
+				Help:        "Rule enabled (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableRuleLabelNames,
+		),
+		ruleTimesTriggered: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "rule",
+				Name:        "times_triggered",
+				Help:        "Number of times the rule has triggered since the bridge started",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableRuleLabelNames,
+		),
+		ruleLastTriggered: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "rule",
+				Name:        "last_triggered_timestamp_seconds",
+				Help:        "Time the rule last triggered (Unix epoch)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableRuleLabelNames,
+		),
+		ruleBrokenReferences: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "rule",
+				Name:        "broken_references",
+				Help:        "Number of conditions and actions of the rule that refer to lights, groups or sensors that don't exist",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableRuleLabelNames,
+		),
+		ruleScrapesFailed: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "rule",
+				Name:        "scrapes_failed",
+				Help:        "Count of scrapes of rule data from the Hue bridge that have failed",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+	}
+
+	return c
+}
+
+func (c ruleCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.ruleInfo.Describe(ch)
+	c.ruleEnabled.Describe(ch)
+	c.ruleTimesTriggered.Describe(ch)
+	c.ruleLastTriggered.Describe(ch)
+	c.ruleBrokenReferences.Describe(ch)
+	c.ruleScrapesFailed.Describe(ch)
+}
+
+// unfilteredBridge is a Bridge that leaves out the lights, groups and sensors that aren't exported, but can
+// still give all of them
+type unfilteredBridge interface {
+	GetUnfilteredDatastore() (*datastore.Datastore, error)
+}
+
+// resourceIDs returns the IDs of the lights, groups and sensors on the bridge, by the path of their type in
+// the API, or nil if they aren't all known. Devices that aren't exported are included, as rules can still
+// refer to them.
+func (c ruleCollector) resourceIDs() map[string]map[string]bool {
+	var lights []hue.Light
+	var groups []hue.Group
+	var sensors []hue.Sensor
+	if bridge, ok := c.bridge.(unfilteredBridge); ok {
+		d, err := bridge.GetUnfilteredDatastore()
+		if err != nil {
+			log.Errorf("Failed to look up resources for rules: %v", err)
+			return nil
+		}
+		lights, groups, sensors = d.Lights, d.Groups, d.Sensors
+	} else {
+		var err error
+		if lights, err = c.bridge.GetAllLights(); err != nil {
+			log.Errorf("Failed to look up lights for rules: %v", err)
+			return nil
+		}
+		if groups, err = c.bridge.GetAllGroups(); err != nil {
+			log.Errorf("Failed to look up groups for rules: %v", err)
+			return nil
+		}
+		if sensors, err = c.bridge.GetAllSensors(); err != nil {
+			log.Errorf("Failed to look up sensors for rules: %v", err)
+			return nil
+		}
+	}
+
+	ids := map[string]map[string]bool{
+		"lights": make(map[string]bool),
+		// Group 0 is every light on the bridge, and is never listed
+		"groups":  map[string]bool{"0": true},
+		"sensors": make(map[string]bool),
+	}
+	for _, light := range lights {
+		ids["lights"][strconv.Itoa(light.Index)] = true
+	}
+	for _, group := range groups {
+		ids["groups"][strconv.Itoa(group.Index)] = true
+	}
+	for _, sensor := range sensors {
+		ids["sensors"][strconv.Itoa(sensor.Index)] = true
+	}
+	return ids
+}
+
+// brokenReferences counts the conditions and actions of a rule whose addresses refer to lights, groups or
+// sensors that don't exist
+func brokenReferences(rule datastore.Rule, ids map[string]map[string]bool) int {
+	addresses := make([]string, 0, len(rule.Conditions)+len(rule.Actions))
+	for _, condition := range rule.Conditions {
+		addresses = append(addresses, condition.Address)
+	}
+	for _, action := range rule.Actions {
+		addresses = append(addresses, commandTarget(action.Address))
+	}
+
+	broken := 0
+	for _, address := range addresses {
+		parts := strings.SplitN(strings.TrimPrefix(address, "/"), "/", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		if known, ok := ids[parts[0]]; ok && !known[parts[1]] {
+			broken++
+		}
+	}
+	return broken
+}
+
+func (c ruleCollector) Collect(ch chan<- prometheus.Metric) {
+	c.ruleInfo.Reset()
+	c.ruleEnabled.Reset()
+	c.ruleTimesTriggered.Reset()
+	c.ruleLastTriggered.Reset()
+	c.ruleBrokenReferences.Reset()
+
+	rules, err := c.bridge.GetAllRules()
+	if err != nil {
+		log.Errorf("Failed to update rules: %v", err)
+		c.ruleScrapesFailed.Inc()
+	}
+	owners := apiUserNames(c.bridge)
+	ids := c.resourceIDs()
+
+	for _, rule := range rules {
+		ruleLabels := prometheus.Labels{
+			"name":    rule.Name,
+			"rule_id": rule.ID,
+		}
+
+		c.ruleInfo.WithLabelValues(owners[rule.Owner], rule.Status, rule.Name, rule.ID).Set(1)
+		if rule.Status == "enabled" {
+			c.ruleEnabled.With(ruleLabels).Set(1)
+		} else {
+			c.ruleEnabled.With(ruleLabels).Set(0)
+		}
+		c.ruleTimesTriggered.With(ruleLabels).Set(float64(rule.TimesTriggered))
+		lastTriggered, err := datastore.ParseTime(rule.LastTriggered)
+		if err != nil {
+			log.Errorf("Failed to parse last triggered time of rule %v: %v", rule.Name, err)
+		} else if !lastTriggered.IsZero() {
+			c.ruleLastTriggered.With(ruleLabels).Set(float64(lastTriggered.Unix()))
+		}
+		if ids != nil {
+			c.ruleBrokenReferences.With(ruleLabels).Set(float64(brokenReferences(rule, ids)))
+		}
+	}
+
+	c.ruleInfo.Collect(ch)
+	c.ruleEnabled.Collect(ch)
+	c.ruleTimesTriggered.Collect(ch)
+	c.ruleLastTriggered.Collect(ch)
+	c.ruleBrokenReferences.Collect(ch)
+	c.ruleScrapesFailed.Collect(ch)
+}
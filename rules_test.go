@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/mitchellrj/hue_exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRuleCollector(t *testing.T) {
+	bridge := test.NewStubBridge().
+		WithLights([]hue.Light{hue.Light{Index: 1}}).
+		WithGroups([]hue.Group{hue.Group{Index: 1}}).
+		WithSensors([]hue.Sensor{hue.Sensor{Index: 2}}).
+		WithRules([]datastore.Rule{
+			datastore.Rule{
+				ID:             "1",
+				Name:           "Dimmer on",
+				Status:         "enabled",
+				TimesTriggered: 42,
+				LastTriggered:  "2018-09-12T18:40:51",
+				Conditions: []datastore.Condition{
+					datastore.Condition{Address: "/sensors/2/state/buttonevent", Operator: "eq", Value: "1002"},
+					datastore.Condition{Address: "/config/localtime", Operator: "in", Value: "T08:00:00/T20:00:00"},
+				},
+				Actions: []datastore.Action{
+					datastore.Action{Address: "/groups/1/action", Method: "PUT"},
+					datastore.Action{Address: "/groups/0/action", Method: "PUT"},
+				},
+			},
+			datastore.Rule{
+				ID:            "2",
+				Name:          "Old switch",
+				Status:        "resourcedeleted",
+				LastTriggered: "none",
+				Conditions: []datastore.Condition{
+					datastore.Condition{Address: "/sensors/5/state/buttonevent", Operator: "eq", Value: "1002"},
+				},
+				Actions: []datastore.Action{
+					datastore.Action{Address: "/lights/3/state", Method: "PUT"},
+					datastore.Action{Address: "/lights/1/state", Method: "PUT"},
+				},
+			},
+		})
+
+	collector := NewRuleCollector("test_hue", bridge, "test").(ruleCollector)
+	metrics := make(chan prometheus.Metric, 20)
+	collector.Collect(metrics)
+	close(metrics)
+
+	if actual := gaugeValue(t, collector.ruleTimesTriggered.WithLabelValues("Dimmer on", "1")); actual != 42 {
+		t.Errorf("Expected rule to have triggered 42 times, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.ruleLastTriggered.WithLabelValues("Dimmer on", "1")); actual != 1536777651 {
+		t.Errorf("Expected rule last triggered at 1536777651, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.ruleEnabled.WithLabelValues("Old switch", "2")); actual != 0 {
+		t.Errorf("Expected rule to be disabled, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.ruleBrokenReferences.WithLabelValues("Dimmer on", "1")); actual != 0 {
+		t.Errorf("Expected no broken references, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.ruleBrokenReferences.WithLabelValues("Old switch", "2")); actual != 2 {
+		t.Errorf("Expected 2 broken references, got %v", actual)
+	}
+}
+
+func TestRuleCollectorFilteredReferences(t *testing.T) {
+	stub := test.NewStubBridge().
+		WithSensors([]hue.Sensor{hue.Sensor{Index: 2, Name: "Dimmer status", Type: "CLIPGenericStatus"}}).
+		WithRules([]datastore.Rule{
+			datastore.Rule{
+				ID:     "1",
+				Name:   "Dimmer status",
+				Status: "enabled",
+				Conditions: []datastore.Condition{
+					datastore.Condition{Address: "/sensors/2/state/status", Operator: "eq", Value: "1"},
+				},
+			},
+		})
+	filters, err := newDeviceFilters(FilterConfig{
+		Sensors: DeviceFilterConfig{Exclude: []DeviceMatchConfig{{Type: "CLIPGenericStatus"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge := newSnapshotBridge("test_hue", stub, "test", time.Minute)
+	bridge.filter(filters)
+
+	collector := NewRuleCollector("test_hue", bridge, "test").(ruleCollector)
+	metrics := make(chan prometheus.Metric, 20)
+	collector.Collect(metrics)
+	close(metrics)
+
+	if actual := gaugeValue(t, collector.ruleBrokenReferences.WithLabelValues("Dimmer status", "1")); actual != 0 {
+		t.Errorf("Expected a reference to a filtered sensor not to be broken, got %v", actual)
+	}
+}
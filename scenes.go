@@ -0,0 +1,164 @@
+package main
+
+import (
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/prometheus/common/log"
+)
+
+type sceneCollector struct {
+	bridge             Bridge
+	sceneInfo          *prometheus.GaugeVec
+	sceneLights        *prometheus.GaugeVec
+	sceneLastUpdated   *prometheus.GaugeVec
+	sceneLocked        *prometheus.GaugeVec
+	sceneRecycle       *prometheus.GaugeVec
+	sceneCount         prometheus.Gauge
+	sceneScrapesFailed prometheus.Counter
+}
+
+var variableSceneLabelNames = []string{
+	"name",
+	"scene_id",
+}
+
+var sceneInfoLabelNames = append([]string{"owner"}, variableSceneLabelNames...)
+
+// NewSceneCollector Create a new Hue collector for scenes
+func NewSceneCollector(namespace string, bridge Bridge, bridgeName string) prometheus.Collector {
+	c := sceneCollector{
+		bridge: bridge,
+		sceneInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "scene",
+				Name:        "info",
+				Help:        "Scene information (always 1)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			sceneInfoLabelNames,
+		),
+		sceneLights: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "scene",
+				Name:        "lights",
+				Help:        "Number of lights in the scene",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableSceneLabelNames,
+		),
+		sceneLastUpdated: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "scene",
+				Name:        "last_updated_timestamp_seconds",
+				Help:        "Time the scene was last updated (Unix epoch)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableSceneLabelNames,
+		),
+		sceneLocked: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "scene",
+				Name:        "locked",
+				Help:        "Scene locked by a rule or schedule that uses it (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableSceneLabelNames,
+		),
+		sceneRecycle: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "scene",
+				Name:        "recycle",
+				Help:        "Scene may be deleted by the bridge when space is needed (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableSceneLabelNames,
+		),
+		sceneCount: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "scene",
+				Name:        "count",
+				Help:        "Number of scenes stored on the bridge",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+		sceneScrapesFailed: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "scene",
+				Name:        "scrapes_failed",
+				Help:        "Count of scrapes of scene data from the Hue bridge that have failed",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+	}
+
+	return c
+}
+
+func (c sceneCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.sceneInfo.Describe(ch)
+	c.sceneLights.Describe(ch)
+	c.sceneLastUpdated.Describe(ch)
+	c.sceneLocked.Describe(ch)
+	c.sceneRecycle.Describe(ch)
+	c.sceneCount.Describe(ch)
+	c.sceneScrapesFailed.Describe(ch)
+}
+
+func (c sceneCollector) Collect(ch chan<- prometheus.Metric) {
+	c.sceneInfo.Reset()
+	c.sceneLights.Reset()
+	c.sceneLastUpdated.Reset()
+	c.sceneLocked.Reset()
+	c.sceneRecycle.Reset()
+
+	scenes, err := c.bridge.GetAllScenes()
+	if err != nil {
+		log.Errorf("Failed to update scenes: %v", err)
+		c.sceneScrapesFailed.Inc()
+	}
+	owners := apiUserNames(c.bridge)
+
+	for _, scene := range scenes {
+		sceneLabels := prometheus.Labels{
+			"name":     scene.Name,
+			"scene_id": scene.ID,
+		}
+
+		c.sceneInfo.WithLabelValues(owners[scene.Owner], scene.Name, scene.ID).Set(1)
+		c.sceneLights.With(sceneLabels).Set(float64(len(scene.Lights)))
+		lastUpdated, err := datastore.ParseTime(scene.Lastupdated)
+		if err != nil {
+			log.Errorf("Failed to parse last updated time of scene %v: %v", scene.Name, err)
+		} else if !lastUpdated.IsZero() {
+			c.sceneLastUpdated.With(sceneLabels).Set(float64(lastUpdated.Unix()))
+		}
+		if scene.Locked {
+			c.sceneLocked.With(sceneLabels).Set(1)
+		} else {
+			c.sceneLocked.With(sceneLabels).Set(0)
+		}
+		if scene.Recycle {
+			c.sceneRecycle.With(sceneLabels).Set(1)
+		} else {
+			c.sceneRecycle.With(sceneLabels).Set(0)
+		}
+	}
+
+	c.sceneInfo.Collect(ch)
+	c.sceneLights.Collect(ch)
+	c.sceneLastUpdated.Collect(ch)
+	c.sceneLocked.Collect(ch)
+	c.sceneRecycle.Collect(ch)
+	if err == nil {
+		c.sceneCount.Set(float64(len(scenes)))
+		c.sceneCount.Collect(ch)
+	}
+	c.sceneScrapesFailed.Collect(ch)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/mitchellrj/hue_exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSceneCollector(t *testing.T) {
+	var config datastore.Config
+	err := json.Unmarshal([]byte(`{"whitelist": {"key": {"name": "Hue 3#iPhone"}}}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge := test.NewStubBridge().WithConfig(config).WithScenes([]hue.Scene{
+		hue.Scene{
+			ID:          "abc",
+			Name:        "Bright",
+			Lights:      []string{"1", "2"},
+			Owner:       "key",
+			Locked:      true,
+			Lastupdated: "2018-03-01T10:00:00",
+		},
+		hue.Scene{
+			ID:      "def",
+			Name:    "Dimmed",
+			Lights:  []string{"1"},
+			Recycle: true,
+		},
+	})
+
+	collector := NewSceneCollector("test_hue", bridge, "test").(sceneCollector)
+	metrics := make(chan prometheus.Metric, 20)
+	collector.Collect(metrics)
+	close(metrics)
+
+	if actual := gaugeValue(t, collector.sceneInfo.WithLabelValues("Hue 3#iPhone", "Bright", "abc")); actual != 1 {
+		t.Errorf("Expected scene info of 1, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sceneLights.WithLabelValues("Bright", "abc")); actual != 2 {
+		t.Errorf("Expected 2 lights in scene, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sceneLastUpdated.WithLabelValues("Bright", "abc")); actual != 1519898400 {
+		t.Errorf("Expected scene updated at 1519898400, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sceneLocked.WithLabelValues("Bright", "abc")); actual != 1 {
+		t.Errorf("Expected scene to be locked, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sceneRecycle.WithLabelValues("Dimmed", "def")); actual != 1 {
+		t.Errorf("Expected scene to be recyclable, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sceneCount); actual != 2 {
+		t.Errorf("Expected 2 scenes, got %v", actual)
+	}
+}
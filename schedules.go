@@ -0,0 +1,171 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/prometheus/common/log"
+)
+
+type scheduleCollector struct {
+	bridge                Bridge
+	scheduleInfo          *prometheus.GaugeVec
+	scheduleEnabled       *prometheus.GaugeVec
+	scheduleNextTrigger   *prometheus.GaugeVec
+	scheduleScrapesFailed prometheus.Counter
+}
+
+var variableScheduleLabelNames = []string{
+	"name",
+	"schedule_id",
+}
+
+var scheduleInfoLabelNames = append([]string{"target", "method", "time_pattern"}, variableScheduleLabelNames...)
+
+// NewScheduleCollector Create a new Hue collector for schedules
+func NewScheduleCollector(namespace string, bridge Bridge, bridgeName string) prometheus.Collector {
+	c := scheduleCollector{
+		bridge: bridge,
+		scheduleInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "schedule",
+				Name:        "info",
+				Help:        "Schedule information (always 1)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			scheduleInfoLabelNames,
+		),
+		scheduleEnabled: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "schedule",
+				Name:        "enabled",
+				Help:        "Schedule enabled (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableScheduleLabelNames,
+		),
+		scheduleNextTrigger: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "schedule",
+				Name:        "next_trigger_timestamp_seconds",
+				Help:        "Earliest time the schedule will next trigger, before any random offset (Unix epoch)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			variableScheduleLabelNames,
+		),
+		scheduleScrapesFailed: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "schedule",
+				Name:        "scrapes_failed",
+				Help:        "Count of scrapes of schedule data from the Hue bridge that have failed",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+	}
+
+	return c
+}
+
+func (c scheduleCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.scheduleInfo.Describe(ch)
+	c.scheduleEnabled.Describe(ch)
+	c.scheduleNextTrigger.Describe(ch)
+	c.scheduleScrapesFailed.Describe(ch)
+}
+
+// commandTarget returns the resource a command is sent to, without the username that its address starts with
+func commandTarget(address string) string {
+	if !strings.HasPrefix(address, "/api/") {
+		return address
+	}
+	parts := strings.SplitN(address, "/", 4)
+	if len(parts) < 4 {
+		return "/"
+	}
+	return "/" + parts[3]
+}
+
+// bridgeLocation returns the bridge's time zone, in which schedules are set
+func (c scheduleCollector) bridgeLocation() *time.Location {
+	d, err := c.bridge.GetDatastore()
+	if err != nil {
+		log.Errorf("Failed to look up bridge time zone: %v", err)
+		return time.UTC
+	}
+	if d.Config.TimeZone == "" || d.Config.TimeZone == "none" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(d.Config.TimeZone)
+	if err != nil {
+		log.Errorf("Failed to load bridge time zone: %v", err)
+		return time.UTC
+	}
+	return loc
+}
+
+// nextTrigger returns the earliest time a schedule will next trigger, and whether it will trigger again
+func (c scheduleCollector) nextTrigger(schedule datastore.Schedule, loc *time.Location, now time.Time) (time.Time, bool) {
+	value := schedule.Localtime
+	if value == "" {
+		// Older bridges only have the time in UTC
+		value = schedule.Time
+		loc = time.UTC
+	}
+	pattern, err := datastore.ParseTimePattern(value, loc)
+	if err != nil {
+		log.Errorf("Failed to parse time of schedule %v: %v", schedule.Name, err)
+		return time.Time{}, false
+	}
+	start, err := datastore.ParseTime(schedule.StartTime)
+	if err != nil {
+		log.Errorf("Failed to parse start time of schedule %v: %v", schedule.Name, err)
+		return time.Time{}, false
+	}
+	return pattern.Next(now, start)
+}
+
+func (c scheduleCollector) Collect(ch chan<- prometheus.Metric) {
+	c.scheduleInfo.Reset()
+	c.scheduleEnabled.Reset()
+	c.scheduleNextTrigger.Reset()
+
+	schedules, err := c.bridge.GetAllSchedules()
+	if err != nil {
+		log.Errorf("Failed to update schedules: %v", err)
+		c.scheduleScrapesFailed.Inc()
+	}
+	loc := c.bridgeLocation()
+	now := time.Now()
+
+	for _, schedule := range schedules {
+		scheduleLabels := prometheus.Labels{
+			"name":        schedule.Name,
+			"schedule_id": schedule.ID,
+		}
+		timePattern := schedule.Localtime
+		if timePattern == "" {
+			timePattern = schedule.Time
+		}
+
+		c.scheduleInfo.WithLabelValues(commandTarget(schedule.Command.Address), schedule.Command.Method, timePattern, schedule.Name, schedule.ID).Set(1)
+		if schedule.Status == "enabled" {
+			c.scheduleEnabled.With(scheduleLabels).Set(1)
+			if next, ok := c.nextTrigger(schedule, loc, now); ok {
+				c.scheduleNextTrigger.With(scheduleLabels).Set(float64(next.Unix()))
+			}
+		} else {
+			c.scheduleEnabled.With(scheduleLabels).Set(0)
+		}
+	}
+
+	c.scheduleInfo.Collect(ch)
+	c.scheduleEnabled.Collect(ch)
+	c.scheduleNextTrigger.Collect(ch)
+	c.scheduleScrapesFailed.Collect(ch)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/mitchellrj/hue_exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScheduleCollector(t *testing.T) {
+	alarm := datastore.Schedule{}
+	alarm.ID = "1"
+	alarm.Name = "Wake up"
+	alarm.Command.Address = "/api/key/groups/1/action"
+	alarm.Command.Method = "PUT"
+	alarm.Localtime = "W127/T07:00:00"
+	alarm.Status = "enabled"
+	timer := datastore.Schedule{StartTime: time.Now().UTC().Format(datastore.TimeFormat)}
+	timer.ID = "2"
+	timer.Name = "Timer"
+	timer.Localtime = "PT01:00:00"
+	timer.Status = "disabled"
+	bridge := test.NewStubBridge().WithSchedules([]datastore.Schedule{alarm, timer})
+
+	collector := NewScheduleCollector("test_hue", bridge, "test").(scheduleCollector)
+	metrics := make(chan prometheus.Metric, 20)
+	collector.Collect(metrics)
+	close(metrics)
+
+	if actual := gaugeValue(t, collector.scheduleInfo.WithLabelValues("/groups/1/action", "PUT", "W127/T07:00:00", "Wake up", "1")); actual != 1 {
+		t.Errorf("Expected schedule info of 1, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.scheduleEnabled.WithLabelValues("Timer", "2")); actual != 0 {
+		t.Errorf("Expected timer to be disabled, got %v", actual)
+	}
+	next := time.Unix(int64(gaugeValue(t, collector.scheduleNextTrigger.WithLabelValues("Wake up", "1"))), 0).UTC()
+	if next.Hour() != 7 || next.Minute() != 0 || next.Before(time.Now()) || next.After(time.Now().Add(24*time.Hour)) {
+		t.Errorf("Expected alarm to next trigger at 07:00 UTC within a day, got %v", next)
+	}
+	if len(metrics) != 6 {
+		t.Errorf("Expected no next trigger time for the disabled timer, got %v metrics", len(metrics))
+	}
+}
+
+func TestCommandTarget(t *testing.T) {
+	for address, expected := range map[string]string{
+		"/api/key/groups/1/action": "/groups/1/action",
+		"/api/key":                 "/",
+		"/groups/1/action":         "/groups/1/action",
+	} {
+		if actual := commandTarget(address); actual != expected {
+			t.Errorf("Expected target %v for %v, got %v", expected, address, actual)
+		}
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"math"
+	"strconv"
+	"strings"
 
 	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/prometheus/common/log"
 )
@@ -12,16 +15,37 @@ type sensorCollector struct {
 	bridge              Bridge
 	ignoreTypes         []string
 	matchNames          bool
+	legacyValue         bool
 	sensorValue         *prometheus.GaugeVec
 	sensorLastUpdated   *prometheus.GaugeVec
 	sensorOn            *prometheus.GaugeVec
 	sensorBattery       *prometheus.GaugeVec
 	sensorReachable     *prometheus.GaugeVec
+	sensorInfo          *prometheus.GaugeVec
 	sensorScrapesFailed prometheus.Counter
 	bridgeRestarts      prometheus.Counter
+
+	// Configuration of the Hue motion sensor and of the daylight sensor
+	sensorSensitivity       *prometheus.GaugeVec
+	sensorSensitivityMax    *prometheus.GaugeVec
+	sensorLEDIndication     *prometheus.GaugeVec
+	sensorUserTest          *prometheus.GaugeVec
+	sensorDarkThreshold     *prometheus.GaugeVec
+	sensorDaylightThreshold *prometheus.GaugeVec
+	sensorDark              *prometheus.GaugeVec
+	sensorDaylight          *prometheus.GaugeVec
+	sensorSunriseOffset     *prometheus.GaugeVec
+	sensorSunsetOffset      *prometheus.GaugeVec
+
+	// Values in physical units, in place of sensorValue
+	sensorTemperature     *prometheus.GaugeVec
+	sensorIlluminance     *prometheus.GaugeVec
+	sensorPresence        *prometheus.GaugeVec
+	switchLastButtonEvent *prometheus.GaugeVec
 }
 
 var variableSensorLabelNames = []string{
+	"id",
 	"name",
 	"type",
 	"model_id",
@@ -40,6 +64,25 @@ func contains(a []string, x string) bool {
 	return false
 }
 
+// labelsForSensor returns the labels of a sensor under its own name. The device ID of the sensors that make up
+// a physical device is the part of their unique IDs that they share.
+func labelsForSensor(sensor hue.Sensor, ids datastore.IDs) prometheus.Labels {
+	deviceID := sensor.UniqueID
+	if (strings.HasPrefix(sensor.Type, "ZLL") || strings.HasPrefix(sensor.Type, "ZGP")) && len(deviceID) > 23 {
+		deviceID = deviceID[0:23]
+	}
+	return deviceLabels(prometheus.Labels{
+		"id":                ids.Sensor(sensor),
+		"name":              sensor.Name,
+		"model_id":          sensor.ModelID,
+		"manufacturer_name": sensor.ManufacturerName,
+		"type":              sensor.Type,
+		"unique_id":         sensor.UniqueID,
+		"device_id":         deviceID,
+		"product_name":      sensor.ProductName,
+	})
+}
+
 func max(a, b int64) int64 {
 	if a > b {
 		return a
@@ -47,71 +90,230 @@ func max(a, b int64) int64 {
 	return b
 }
 
-// NewSensorCollector Create a new Hue collector for sensors
-func NewSensorCollector(namespace string, bridge Bridge, ignoreTypes []string, matchNames bool) prometheus.Collector {
+// NewSensorCollector Create a new Hue collector for sensors. The raw values of sensors are only exported as
+// hue_sensor_value when legacyValue is set.
+func NewSensorCollector(namespace string, bridge Bridge, bridgeName string, ignoreTypes []string, matchNames bool, legacyValue bool) prometheus.Collector {
 	c := sensorCollector{
 		bridge:      bridge,
 		ignoreTypes: ignoreTypes,
 		matchNames:  matchNames,
+		legacyValue: legacyValue,
 		sensorValue: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "sensor",
-				Name:      "value",
-				Help:      "Sensor values",
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "value",
+				Help:        "Sensor values",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableSensorLabelNames,
+			labelNames(variableSensorLabelNames),
 		),
 		sensorBattery: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "sensor",
-				Name:      "battery",
-				Help:      "Sensor battery levels (%)",
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "battery",
+				Help:        "Sensor battery levels (%)",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableSensorLabelNames,
+			labelNames(variableSensorLabelNames),
 		),
 		sensorLastUpdated: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "sensor",
-				Name:      "last_updated",
-				Help:      "Sensor last updated time",
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "last_updated",
+				Help:        "Sensor last updated time",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableSensorLabelNames,
+			labelNames(variableSensorLabelNames),
 		),
 		sensorOn: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "sensor",
-				Name:      "on",
-				Help:      "Sensor on/off (1/0)",
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "on",
+				Help:        "Sensor on/off (1/0)",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableSensorLabelNames,
+			labelNames(variableSensorLabelNames),
 		),
 		sensorReachable: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "sensor",
-				Name:      "reachable",
-				Help:      "Sensor reachability (1/0)",
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "reachable",
+				Help:        "Sensor reachability (1/0)",
+				ConstLabels: constLabels(bridgeName),
 			},
-			variableSensorLabelNames,
+			labelNames(variableSensorLabelNames),
+		),
+		sensorSensitivity: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "sensitivity",
+				Help:        "Motion sensor movement sensitivity level",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorSensitivityMax: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "sensitivity_max",
+				Help:        "Maximum movement sensitivity level of the motion sensor",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorLEDIndication: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "led_indication",
+				Help:        "Motion sensor LED lights on motion (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorUserTest: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "user_test",
+				Help:        "Motion sensor in user test mode (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorDarkThreshold: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "dark_threshold_lux",
+				Help:        "Illuminance below which the sensor considers it dark",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorDaylightThreshold: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "daylight_threshold_lux",
+				Help:        "Illuminance above which the sensor considers it daylight",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorDark: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "dark",
+				Help:        "Light level is below the dark threshold (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorDaylight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "daylight",
+				Help:        "Light level is above the daylight threshold (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorSunriseOffset: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "sunrise_offset_seconds",
+				Help:        "Offset from sunrise after which the daylight sensor considers it daylight",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorSunsetOffset: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "sunset_offset_seconds",
+				Help:        "Offset from sunset before which the daylight sensor considers it daylight",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorTemperature: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "temperature_celsius",
+				Help:        "Temperature measured by the sensor",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorIlluminance: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "illuminance_lux",
+				Help:        "Illuminance measured by the light level sensor",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		sensorPresence: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "presence",
+				Help:        "Presence detected by the sensor (1/0)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableSensorLabelNames),
+		),
+		switchLastButtonEvent: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "switch",
+				Name:        "last_button_event",
+				Help:        "The button and action of the latest event of the switch",
+				ConstLabels: constLabels(bridgeName),
+			},
+			append(labelNames(variableSensorLabelNames), "button", "action"),
+		),
+		sensorInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "info",
+				Help:        "Name and software version of the sensor",
+				ConstLabels: constLabels(bridgeName),
+			},
+			infoLabelNames(variableSensorLabelNames, "swversion"),
 		),
 		sensorScrapesFailed: prometheus.NewCounter(
 			prometheus.CounterOpts{
-				Namespace: namespace,
-				Subsystem: "sensor",
-				Name:      "scrapes_failed",
-				Help:      "Count of scrapes of sensor data from the Hue bridge that have failed",
+				Namespace:   namespace,
+				Subsystem:   "sensor",
+				Name:        "scrapes_failed",
+				Help:        "Count of scrapes of sensor data from the Hue bridge that have failed",
+				ConstLabels: constLabels(bridgeName),
 			},
 		),
 		bridgeRestarts: prometheus.NewCounter(
 			prometheus.CounterOpts{
-				Namespace: namespace,
-				Subsystem: "bridge",
-				Name:      "restarts",
-				Help:      "Count of number of bridge restarts detected",
+				Namespace:   namespace,
+				Subsystem:   "bridge",
+				Name:        "restarts",
+				Help:        "Count of number of bridge restarts detected",
+				ConstLabels: constLabels(bridgeName),
 			},
 		),
 	}
@@ -125,22 +327,37 @@ func (c sensorCollector) Describe(ch chan<- *prometheus.Desc) {
 	c.sensorLastUpdated.Describe(ch)
 	c.sensorOn.Describe(ch)
 	c.sensorReachable.Describe(ch)
+	c.sensorInfo.Describe(ch)
+	c.sensorSensitivity.Describe(ch)
+	c.sensorSensitivityMax.Describe(ch)
+	c.sensorLEDIndication.Describe(ch)
+	c.sensorUserTest.Describe(ch)
+	c.sensorDarkThreshold.Describe(ch)
+	c.sensorDaylightThreshold.Describe(ch)
+	c.sensorDark.Describe(ch)
+	c.sensorDaylight.Describe(ch)
+	c.sensorSunriseOffset.Describe(ch)
+	c.sensorSunsetOffset.Describe(ch)
+	c.sensorTemperature.Describe(ch)
+	c.sensorIlluminance.Describe(ch)
+	c.sensorPresence.Describe(ch)
+	c.switchLastButtonEvent.Describe(ch)
 	c.sensorScrapesFailed.Describe(ch)
 	c.bridgeRestarts.Describe(ch)
 }
 
-func (c sensorCollector) recordSensor(sensor hue.Sensor, sensorName string, deviceID string, sensorValue float64) {
-	sensorLabels := prometheus.Labels{
-		"name":              sensorName,
-		"model_id":          sensor.ModelID,
-		"manufacturer_name": sensor.ManufacturerName,
-		"type":              sensor.Type,
-		"unique_id":         sensor.UniqueID,
-		"device_id":         deviceID,
-		"product_name":      sensor.ProductName,
+func (c sensorCollector) recordSensor(sensor hue.Sensor, ids datastore.IDs, sensorName string, deviceID string, sensorValue float64) {
+	sensorLabels := labelsForSensor(sensor, ids)
+	if _, ok := sensorLabels["name"]; ok {
+		sensorLabels["name"] = sensorName
 	}
+	sensorLabels["device_id"] = deviceID
 
-	c.sensorValue.With(sensorLabels).Set(sensorValue)
+	c.sensorInfo.With(infoLabels(sensorLabels, sensorName, prometheus.Labels{"swversion": sensor.SWVersion})).Set(1)
+
+	if c.legacyValue {
+		c.sensorValue.With(sensorLabels).Set(sensorValue)
+	}
 	c.sensorBattery.With(sensorLabels).Set(float64(sensor.Config.Battery))
 	// let's set a sensible minimum for last updated here: if your sensor last updated before 1970,
 	// something's clearly not right. No need to set it to 1969 /BCE/.
@@ -155,6 +372,85 @@ func (c sensorCollector) recordSensor(sensor hue.Sensor, sensorName string, devi
 	} else {
 		c.sensorReachable.With(sensorLabels).Set(0)
 	}
+	c.recordSensorConfig(sensor, sensorLabels)
+	c.recordSensorState(sensor, sensorLabels)
+}
+
+// recordSensorState records the state of a sensor in physical units, or decoded for switches
+func (c sensorCollector) recordSensorState(sensor hue.Sensor, sensorLabels prometheus.Labels) {
+	switch sensor.Type {
+	case "ZLLTemperature":
+		c.sensorTemperature.With(sensorLabels).Set(float64(sensor.State.Temperature) / 100)
+	case "ZLLLightLevel":
+		c.sensorIlluminance.With(sensorLabels).Set(lightLevelLux(sensor.State.LightLevel))
+	case "ZLLPresence":
+		if sensor.State.Presence {
+			c.sensorPresence.With(sensorLabels).Set(1)
+		} else {
+			c.sensorPresence.With(sensorLabels).Set(0)
+		}
+	case "Daylight":
+		if sensor.State.Daylight {
+			c.sensorDaylight.With(sensorLabels).Set(1)
+		} else {
+			c.sensorDaylight.With(sensorLabels).Set(0)
+		}
+	case "ZLLSwitch", "ZGPSwitch":
+		if button, action, ok := decodeButtonEvent(sensor.Type, sensor.State.ButtonEvent); ok {
+			eventLabels := prometheus.Labels{"button": strconv.Itoa(button), "action": action}
+			for name, value := range sensorLabels {
+				eventLabels[name] = value
+			}
+			c.switchLastButtonEvent.With(eventLabels).Set(1)
+		}
+	}
+}
+
+// lightLevelLux converts the light level reported by the Hue motion sensor, which is 10000 * log10(lux) + 1,
+// to lux
+func lightLevelLux(lightLevel uint16) float64 {
+	if lightLevel == 0 {
+		return 0
+	}
+	return math.Pow(10, float64(lightLevel-1)/10000)
+}
+
+// recordSensorConfig records the configuration of the sensors of the Hue motion sensor and of the bridge's
+// daylight sensor, only for the types that have each setting
+func (c sensorCollector) recordSensorConfig(sensor hue.Sensor, sensorLabels prometheus.Labels) {
+	flag := func(vec *prometheus.GaugeVec, value bool) {
+		if value {
+			vec.With(sensorLabels).Set(1)
+		} else {
+			vec.With(sensorLabels).Set(0)
+		}
+	}
+	switch sensor.Type {
+	case "ZLLPresence":
+		c.sensorSensitivity.With(sensorLabels).Set(float64(sensor.Config.Sensitivity))
+		c.sensorSensitivityMax.With(sensorLabels).Set(float64(sensor.Config.SensitivityMax))
+		flag(c.sensorLEDIndication, sensor.Config.LEDIndication)
+		flag(c.sensorUserTest, sensor.Config.UserTest)
+	case "ZLLLightLevel":
+		c.sensorDarkThreshold.With(sensorLabels).Set(lightLevelLux(sensor.Config.ThresholdDark))
+		// The daylight threshold is an offset from the dark threshold in light level units, which are
+		// logarithmic, so it's only converted once added to it
+		daylight := int(sensor.Config.ThresholdDark) + int(sensor.Config.ThresholdOffset)
+		if daylight > math.MaxUint16 {
+			daylight = math.MaxUint16
+		}
+		c.sensorDaylightThreshold.With(sensorLabels).Set(lightLevelLux(uint16(daylight)))
+		flag(c.sensorDark, sensor.State.Dark)
+		flag(c.sensorDaylight, sensor.State.Daylight)
+		flag(c.sensorLEDIndication, sensor.Config.LEDIndication)
+		flag(c.sensorUserTest, sensor.Config.UserTest)
+	case "ZLLTemperature":
+		flag(c.sensorLEDIndication, sensor.Config.LEDIndication)
+		flag(c.sensorUserTest, sensor.Config.UserTest)
+	case "Daylight":
+		c.sensorSunriseOffset.With(sensorLabels).Set(float64(sensor.Config.SunriseOffset) * 60)
+		c.sensorSunsetOffset.With(sensorLabels).Set(float64(sensor.Config.SunsetOffset) * 60)
+	}
 }
 
 func (c sensorCollector) Collect(ch chan<- prometheus.Metric) {
@@ -163,17 +459,33 @@ func (c sensorCollector) Collect(ch chan<- prometheus.Metric) {
 	c.sensorLastUpdated.Reset()
 	c.sensorOn.Reset()
 	c.sensorReachable.Reset()
+	c.sensorInfo.Reset()
+	c.sensorSensitivity.Reset()
+	c.sensorSensitivityMax.Reset()
+	c.sensorLEDIndication.Reset()
+	c.sensorUserTest.Reset()
+	c.sensorDarkThreshold.Reset()
+	c.sensorDaylightThreshold.Reset()
+	c.sensorDark.Reset()
+	c.sensorDaylight.Reset()
+	c.sensorSunriseOffset.Reset()
+	c.sensorSunsetOffset.Reset()
+	c.sensorTemperature.Reset()
+	c.sensorIlluminance.Reset()
+	c.sensorPresence.Reset()
+	c.switchLastButtonEvent.Reset()
 
-	sensors, err := c.bridge.GetAllSensors()
+	d, err := c.bridge.GetDatastore()
 	if err != nil {
 		log.Errorf("Failed to update sensors: %v", err)
 		c.sensorScrapesFailed.Inc()
+		d = &datastore.Datastore{}
 	}
 	sensorNames := make(map[string]string)
 	sensorLastUpdatedHistory := make(map[string]int64)
 	restartDetected := false
 
-	for _, sensor := range sensors {
+	for _, sensor := range d.Sensors {
 		var sensorValue float64
 		deviceID := sensor.UniqueID
 		if contains(c.ignoreTypes, sensor.Type) {
@@ -193,6 +505,10 @@ func (c sensorCollector) Collect(ch chan<- prometheus.Metric) {
 			sensorValue = float64(sensor.State.ButtonEvent)
 		} else if sensor.Type == "ClipGenericStatus" {
 			sensorValue = float64(sensor.State.Status)
+		} else if sensor.Type == "ZLLContact" {
+			// Hue secure contact sensor, only available through the v2 API
+			deviceID = sensor.UniqueID[0:23]
+			sensorValue = float64(sensor.State.Status)
 		} else if sensor.Type == "ZLLPresence" {
 			deviceID = sensor.UniqueID[0:23]
 			sensorNames[deviceID] = sensor.Name
@@ -206,10 +522,10 @@ func (c sensorCollector) Collect(ch chan<- prometheus.Metric) {
 			restartDetected = true
 		}
 		sensorLastUpdatedHistory[sensor.UniqueID] = sensor.State.LastUpdated.Unix()
-		c.recordSensor(sensor, sensor.Name, deviceID, sensorValue)
+		c.recordSensor(sensor, d.IDs, sensor.Name, deviceID, sensorValue)
 	}
 	// kinda inefficient looping over them twice, but simplies code when name matching is enabled
-	for _, sensor := range sensors {
+	for _, sensor := range d.Sensors {
 		var sensorValue float64
 		if sensor.Type == "ZLLTemperature" {
 			sensorValue = float64(sensor.State.Temperature)
@@ -231,7 +547,7 @@ func (c sensorCollector) Collect(ch chan<- prometheus.Metric) {
 			restartDetected = true
 		}
 		sensorLastUpdatedHistory[sensor.UniqueID] = sensor.State.LastUpdated.Unix()
-		c.recordSensor(sensor, sensorName, deviceID, sensorValue)
+		c.recordSensor(sensor, d.IDs, sensorName, deviceID, sensorValue)
 	}
 
 	if restartDetected {
@@ -243,6 +559,21 @@ func (c sensorCollector) Collect(ch chan<- prometheus.Metric) {
 	c.sensorLastUpdated.Collect(ch)
 	c.sensorOn.Collect(ch)
 	c.sensorReachable.Collect(ch)
+	c.sensorInfo.Collect(ch)
+	c.sensorSensitivity.Collect(ch)
+	c.sensorSensitivityMax.Collect(ch)
+	c.sensorLEDIndication.Collect(ch)
+	c.sensorUserTest.Collect(ch)
+	c.sensorDarkThreshold.Collect(ch)
+	c.sensorDaylightThreshold.Collect(ch)
+	c.sensorDark.Collect(ch)
+	c.sensorDaylight.Collect(ch)
+	c.sensorSunriseOffset.Collect(ch)
+	c.sensorSunsetOffset.Collect(ch)
+	c.sensorTemperature.Collect(ch)
+	c.sensorIlluminance.Collect(ch)
+	c.sensorPresence.Collect(ch)
+	c.switchLastButtonEvent.Collect(ch)
 	c.sensorScrapesFailed.Collect(ch)
 	c.bridgeRestarts.Collect(ch)
 }
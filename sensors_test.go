@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/test"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSensorCollectorConfig(t *testing.T) {
+	presence := hue.Sensor{Name: "Hallway sensor", Type: "ZLLPresence", UniqueID: "00:17:88:01:02:01:64:d1-02-0406"}
+	presence.Config.Sensitivity = 0
+	presence.Config.SensitivityMax = 2
+	presence.Config.UserTest = true
+	lightLevel := hue.Sensor{Name: "Hallway sensor", Type: "ZLLLightLevel", UniqueID: "00:17:88:01:02:01:64:d1-02-0400"}
+	lightLevel.Config.ThresholdDark = 16000
+	lightLevel.Config.ThresholdOffset = 7000
+	lightLevel.Config.LEDIndication = true
+	lightLevel.State.Dark = true
+	daylight := hue.Sensor{Name: "Daylight", Type: "Daylight"}
+	daylight.Config.SunriseOffset = 30
+	daylight.Config.SunsetOffset = -30
+	sensors := []hue.Sensor{presence, lightLevel, daylight}
+	for i := range sensors {
+		sensors[i].State.LastUpdated = hue.UpdateTime{Time: &time.Time{}}
+	}
+	bridge := test.NewStubBridge().WithSensors(sensors)
+
+	collector := NewSensorCollector("test_hue", bridge, "test", nil, false, true).(sensorCollector)
+	metrics := make(chan prometheus.Metric, 100)
+	collector.Collect(metrics)
+	close(metrics)
+
+	labels := func(sensor hue.Sensor) prometheus.Labels {
+		deviceID := sensor.UniqueID
+		if len(deviceID) > 23 {
+			deviceID = deviceID[0:23]
+		}
+		return prometheus.Labels{"id": "0", "name": sensor.Name, "type": sensor.Type, "model_id": "", "manufacturer_name": "", "product_name": "", "unique_id": sensor.UniqueID, "device_id": deviceID}
+	}
+	if actual := gaugeValue(t, collector.sensorSensitivityMax.With(labels(presence))); actual != 2 {
+		t.Errorf("Expected a maximum sensitivity of 2, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sensorUserTest.With(labels(presence))); actual != 1 {
+		t.Errorf("Expected user test mode, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sensorDarkThreshold.With(labels(lightLevel))); math.Abs(actual-lightLevelLux(16000)) > 1e-9 {
+		t.Errorf("Expected a dark threshold of %v lux, got %v", lightLevelLux(16000), actual)
+	}
+	if actual := gaugeValue(t, collector.sensorDaylightThreshold.With(labels(lightLevel))); math.Abs(actual-lightLevelLux(23000)) > 1e-9 {
+		t.Errorf("Expected a daylight threshold of %v lux, got %v", lightLevelLux(23000), actual)
+	}
+	if actual := gaugeValue(t, collector.sensorDark.With(labels(lightLevel))); actual != 1 {
+		t.Errorf("Expected it to be dark, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sensorLEDIndication.With(labels(lightLevel))); actual != 1 {
+		t.Errorf("Expected LED indication, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sensorSunsetOffset.With(labels(daylight))); actual != -1800 {
+		t.Errorf("Expected a sunset offset of -1800 seconds, got %v", actual)
+	}
+
+	// Each sensor has info, a value, battery, last updated, on and reachable, and its state in physical units.
+	// Only presence sensors have their sensitivity, light level sensors their thresholds, and daylight sensors
+	// their offsets.
+	if len(metrics) != 35 {
+		t.Errorf("Expected 35 metrics, got %v", len(metrics))
+	}
+}
+
+func TestSensorCollectorUnits(t *testing.T) {
+	temperature := hue.Sensor{Name: "Hallway sensor", Type: "ZLLTemperature", UniqueID: "00:17:88:01:02:01:64:d1-02-0402"}
+	temperature.State.Temperature = 2154
+	lightLevel := hue.Sensor{Name: "Hallway sensor", Type: "ZLLLightLevel", UniqueID: "00:17:88:01:02:01:64:d1-02-0400"}
+	lightLevel.State.LightLevel = 20001
+	dimmer := hue.Sensor{Name: "Dimmer", Type: "ZLLSwitch", UniqueID: "00:17:88:01:10:3e:3f:cc-02-fc00"}
+	dimmer.State.ButtonEvent = 4003
+	sensors := []hue.Sensor{temperature, lightLevel, dimmer}
+	for i := range sensors {
+		sensors[i].State.LastUpdated = hue.UpdateTime{Time: &time.Time{}}
+	}
+	bridge := test.NewStubBridge().WithSensors(sensors)
+
+	collector := NewSensorCollector("test_hue", bridge, "test", nil, false, false).(sensorCollector)
+	metrics := make(chan prometheus.Metric, 100)
+	collector.Collect(metrics)
+	close(metrics)
+
+	labels := func(sensor hue.Sensor) prometheus.Labels {
+		return prometheus.Labels{"id": "0", "name": sensor.Name, "type": sensor.Type, "model_id": "", "manufacturer_name": "", "product_name": "", "unique_id": sensor.UniqueID, "device_id": sensor.UniqueID[0:23]}
+	}
+	if actual := gaugeValue(t, collector.sensorTemperature.With(labels(temperature))); actual != 21.54 {
+		t.Errorf("Expected 21.54°C, got %v", actual)
+	}
+	if actual := gaugeValue(t, collector.sensorIlluminance.With(labels(lightLevel))); actual != 100 {
+		t.Errorf("Expected 100 lux, got %v", actual)
+	}
+	eventLabels := labels(dimmer)
+	eventLabels["button"] = "4"
+	eventLabels["action"] = "long_release"
+	if actual := gaugeValue(t, collector.switchLastButtonEvent.With(eventLabels)); actual != 1 {
+		t.Errorf("Expected a long release of button 4, got %v", actual)
+	}
+
+	// Without the legacy value, each sensor has info, battery, last updated, on, reachable and its state, and the
+	// temperature and light level sensors have their configuration
+	if len(metrics) != 28 {
+		t.Errorf("Expected 28 metrics, got %v", len(metrics))
+	}
+}
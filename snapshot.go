@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/prometheus/common/log"
+)
+
+// scrapeSnapshotMaxAge is how long a snapshot is shared between collectors when the bridge isn't polled in
+// the background. It only needs to cover the collectors of a single scrape, which all run at once.
+const scrapeSnapshotMaxAge = time.Second
+
+// bridgeSnapshot is the state of a bridge at a single point in time
+type bridgeSnapshot struct {
+	datastore *datastore.Datastore
+	// unfiltered is the datastore with the lights, groups and sensors that filters leave out of datastore
+	unfiltered *datastore.Datastore
+	// capabilities aren't part of the datastore, and are fetched with a second request, which fails on its own
+	capabilities    datastore.Capabilities
+	capabilitiesErr error
+	updated         time.Time
+}
+
+// snapshotBridge is a Bridge that serves every collector from one consistent snapshot of the bridge's
+// datastore, fetched with a single request, and of its capabilities. The snapshot is either refreshed in the
+// background by poll, so that scrapes never make requests to the bridge themselves, or on demand once it is
+// older than maxAge.
+type snapshotBridge struct {
+	bridge Bridge
+	// maxAge is zero when the snapshot is refreshed by poll
+	maxAge time.Duration
+
+	// refreshMutex ensures only one request to the bridge is in flight at a time
+	refreshMutex sync.Mutex
+	mutex        sync.RWMutex
+	current      *bridgeSnapshot
+	// refreshErr is the error from the latest refresh if it failed, at refreshFailed. It's served instead of
+	// refreshing again until the failure is older than maxAge, so that a bridge that isn't responding is only
+	// retried once per scrape. Both are only accessed while holding refreshMutex.
+	refreshErr    error
+	refreshFailed time.Time
+	// observers are called with every new snapshot, and lightObservers with the lights from every poll of
+	// them, while holding refreshMutex. Observers must ignore states older than ones they have already seen.
+	observers      []func(*datastore.Datastore)
+	lightObservers []func(*datastore.Datastore)
+	// filters drops the lights, groups and sensors that aren't exported from every snapshot, or is nil to keep
+	// them all
+	filters *deviceFilters
+
+	snapshotAge     *prometheus.Desc
+	refreshes       prometheus.Counter
+	refreshFailures prometheus.Counter
+}
+
+func newSnapshotBridge(namespace string, bridge Bridge, bridgeName string, maxAge time.Duration) *snapshotBridge {
+	return &snapshotBridge{
+		bridge: bridge,
+		maxAge: maxAge,
+		snapshotAge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "poll", "snapshot_age_seconds"),
+			"Time since the snapshot of bridge data served to scrapes was taken",
+			nil,
+			constLabels(bridgeName),
+		),
+		refreshes: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "poll",
+				Name:        "refreshes_total",
+				Help:        "Count of attempts to refresh the snapshot of bridge data",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+		refreshFailures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "poll",
+				Name:        "refresh_failures_total",
+				Help:        "Count of attempts to refresh the snapshot of bridge data that have failed",
+				ConstLabels: constLabels(bridgeName),
+			},
+		),
+	}
+}
+
+// observe calls f with every new snapshot of the bridge's datastore, in the order they are taken. It must be
+// called before the snapshot is first refreshed.
+func (p *snapshotBridge) observe(f func(*datastore.Datastore)) {
+	p.observers = append(p.observers, f)
+}
+
+// observeLights calls f with the state of the bridge's lights, in a datastore with nothing else, every time
+// pollLights polls them. It must be called before pollLights is started.
+func (p *snapshotBridge) observeLights(f func(*datastore.Datastore)) {
+	p.lightObservers = append(p.lightObservers, f)
+}
+
+// filter drops the lights, groups and sensors that filters don't keep from every snapshot, and from every
+// poll of the lights. It must be called before the snapshot is first refreshed.
+func (p *snapshotBridge) filter(filters deviceFilters) {
+	p.filters = &filters
+}
+
+// lightsBridge is a Bridge that fetches its lights in a datastore, for lights that can only be identified
+// with the IDs in it
+type lightsBridge interface {
+	GetLights() (*datastore.Datastore, error)
+}
+
+// fetchLights fetches the state of the bridge's lights, in a datastore with nothing else
+func (p *snapshotBridge) fetchLights() (*datastore.Datastore, error) {
+	if bridge, ok := p.bridge.(lightsBridge); ok {
+		return bridge.GetLights()
+	}
+	fetched := time.Now()
+	lights, err := p.bridge.GetAllLights()
+	if err != nil {
+		return nil, err
+	}
+	return &datastore.Datastore{Lights: lights, Fetched: fetched}, nil
+}
+
+// pollLights fetches the state of the bridge's lights every interval, forever, for observers that need to see
+// it more often than snapshots are taken. The lights aren't served to collectors. They're fetched without
+// holding refreshMutex, so that scrapes don't wait for them.
+func (p *snapshotBridge) pollLights(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		lights, err := p.fetchLights()
+		if err == nil {
+			if p.filters != nil {
+				lights.Lights = p.filters.filterLights(lights.Lights)
+			}
+			p.refreshMutex.Lock()
+			for _, observer := range p.lightObservers {
+				observer(lights)
+			}
+			p.refreshMutex.Unlock()
+		} else {
+			log.Errorf("Failed to poll bridge lights: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// poll refreshes the snapshot every interval, forever
+func (p *snapshotBridge) poll(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.refreshMutex.Lock()
+		_, err := p.refresh()
+		p.refreshMutex.Unlock()
+		if err != nil {
+			log.Errorf("Failed to refresh bridge snapshot: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// refresh fetches a new snapshot from the bridge. The caller must hold refreshMutex.
+func (p *snapshotBridge) refresh() (*bridgeSnapshot, error) {
+	p.refreshes.Inc()
+	updated := time.Now()
+	d, err := p.bridge.GetDatastore()
+	if err != nil {
+		p.refreshFailures.Inc()
+		p.refreshErr = err
+		p.refreshFailed = time.Now()
+		return nil, err
+	}
+	p.refreshErr = nil
+	snapshot := &bridgeSnapshot{datastore: d, unfiltered: d, updated: updated}
+	snapshot.capabilities, snapshot.capabilitiesErr = p.bridge.GetCapabilities()
+	if p.filters != nil {
+		d = p.filters.apply(d)
+		snapshot.datastore = d
+	}
+	p.mutex.Lock()
+	p.current = snapshot
+	p.mutex.Unlock()
+	for _, observer := range p.observers {
+		observer(d)
+	}
+	return snapshot, nil
+}
+
+// fresh reports whether a snapshot can still be served
+func (p *snapshotBridge) fresh(snapshot *bridgeSnapshot) bool {
+	return snapshot != nil && (p.maxAge == 0 || time.Since(snapshot.updated) < p.maxAge)
+}
+
+// recentFailure returns the error from the latest refresh if it failed and the failure can still be served
+// in place of refreshing again. The caller must hold refreshMutex.
+func (p *snapshotBridge) recentFailure() error {
+	if p.refreshErr == nil || (p.maxAge != 0 && time.Since(p.refreshFailed) >= p.maxAge) {
+		return nil
+	}
+	return p.refreshErr
+}
+
+// snapshot returns the latest snapshot, fetching a new one if it's needed. All callers waiting for a new
+// snapshot share a single request to the bridge, and if it fails, so do all callers until the failure is
+// older than maxAge.
+func (p *snapshotBridge) snapshot() (*bridgeSnapshot, error) {
+	p.mutex.RLock()
+	current := p.current
+	p.mutex.RUnlock()
+	if p.fresh(current) {
+		return current, nil
+	}
+
+	p.refreshMutex.Lock()
+	defer p.refreshMutex.Unlock()
+	// current is only written while holding refreshMutex, so it's safe to read here
+	if p.fresh(p.current) {
+		return p.current, nil
+	}
+	err := p.recentFailure()
+	if err == nil {
+		current, err = p.refresh()
+	}
+	if err != nil {
+		return nil, errors.New("no snapshot of bridge data is available: " + err.Error())
+	}
+	return current, nil
+}
+
+func (p *snapshotBridge) Login(apiKey string) error {
+	return p.bridge.Login(apiKey)
+}
+
+func (p *snapshotBridge) GetDatastore() (*datastore.Datastore, error) {
+	snapshot, err := p.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.datastore, nil
+}
+
+// GetUnfilteredDatastore returns the snapshot of the datastore including the lights, groups and sensors that
+// filters leave out
+func (p *snapshotBridge) GetUnfilteredDatastore() (*datastore.Datastore, error) {
+	snapshot, err := p.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.unfiltered, nil
+}
+
+func (p *snapshotBridge) GetAllLights() ([]hue.Light, error) {
+	snapshot, err := p.snapshot()
+	if err != nil {
+		return []hue.Light{}, err
+	}
+	return snapshot.datastore.Lights, nil
+}
+
+func (p *snapshotBridge) GetAllGroups() ([]hue.Group, error) {
+	snapshot, err := p.snapshot()
+	if err != nil {
+		return []hue.Group{}, err
+	}
+	return snapshot.datastore.Groups, nil
+}
+
+func (p *snapshotBridge) GetAllSensors() ([]hue.Sensor, error) {
+	snapshot, err := p.snapshot()
+	if err != nil {
+		return []hue.Sensor{}, err
+	}
+	return snapshot.datastore.Sensors, nil
+}
+
+func (p *snapshotBridge) GetAllScenes() ([]hue.Scene, error) {
+	snapshot, err := p.snapshot()
+	if err != nil {
+		return []hue.Scene{}, err
+	}
+	return snapshot.datastore.Scenes, nil
+}
+
+func (p *snapshotBridge) GetAllSchedules() ([]datastore.Schedule, error) {
+	snapshot, err := p.snapshot()
+	if err != nil {
+		return []datastore.Schedule{}, err
+	}
+	return snapshot.datastore.Schedules, nil
+}
+
+func (p *snapshotBridge) GetAllRules() ([]datastore.Rule, error) {
+	snapshot, err := p.snapshot()
+	if err != nil {
+		return []datastore.Rule{}, err
+	}
+	return snapshot.datastore.Rules, nil
+}
+
+func (p *snapshotBridge) GetCapabilities() (datastore.Capabilities, error) {
+	snapshot, err := p.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.capabilities, snapshot.capabilitiesErr
+}
+
+func (p *snapshotBridge) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.snapshotAge
+	p.refreshes.Describe(ch)
+	p.refreshFailures.Describe(ch)
+}
+
+func (p *snapshotBridge) Collect(ch chan<- prometheus.Metric) {
+	p.mutex.RLock()
+	current := p.current
+	p.mutex.RUnlock()
+	if current != nil {
+		ch <- prometheus.MustNewConstMetric(p.snapshotAge, prometheus.GaugeValue, time.Since(current.updated).Seconds())
+	}
+	p.refreshes.Collect(ch)
+	p.refreshFailures.Collect(ch)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/mitchellrj/hue_exporter/test"
+)
+
+// countingBridge counts the requests for the full datastore made to the bridge it wraps
+type countingBridge struct {
+	Bridge
+	mutex sync.Mutex
+	calls int
+}
+
+func (b *countingBridge) GetDatastore() (*datastore.Datastore, error) {
+	b.mutex.Lock()
+	b.calls++
+	b.mutex.Unlock()
+	return b.Bridge.GetDatastore()
+}
+
+func TestSnapshotBridgeSharesSnapshot(t *testing.T) {
+	bridge := &countingBridge{Bridge: test.NewStubBridge().WithLights([]hue.Light{
+		hue.Light{Name: "Hallway"},
+	})}
+	snapshot := newSnapshotBridge("test_hue", bridge, "test", time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lights, err := snapshot.GetAllLights()
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if len(lights) != 1 {
+				t.Errorf("Expected 1 light, got %d", len(lights))
+			}
+			snapshot.GetAllGroups()
+			snapshot.GetAllSensors()
+		}()
+	}
+	wg.Wait()
+
+	if bridge.calls != 1 {
+		t.Errorf("Expected one request to the bridge, got %d", bridge.calls)
+	}
+}
+
+func TestSnapshotBridgeRefreshesOnDemand(t *testing.T) {
+	stub := test.NewStubBridge()
+	bridge := &countingBridge{Bridge: stub}
+	snapshot := newSnapshotBridge("test_hue", bridge, "test", time.Nanosecond)
+
+	snapshot.GetAllLights()
+	time.Sleep(time.Millisecond)
+	snapshot.GetAllLights()
+	if bridge.calls != 2 {
+		t.Errorf("Expected two requests to the bridge, got %d", bridge.calls)
+	}
+
+	stub.WithFailure(test.GetDatastoreFailure)
+	time.Sleep(time.Millisecond)
+	if _, err := snapshot.GetAllLights(); err == nil {
+		t.Error("Expected an error once the snapshot is stale and the bridge is failing")
+	}
+}
+
+func TestSnapshotBridgeSharesFailure(t *testing.T) {
+	stub := test.NewStubBridge().WithFailure(test.GetDatastoreFailure)
+	bridge := &countingBridge{Bridge: stub}
+	snapshot := newSnapshotBridge("test_hue", bridge, "test", 20*time.Millisecond)
+
+	if _, err := snapshot.GetAllLights(); err == nil {
+		t.Error("Expected an error while the bridge is failing")
+	}
+	if _, err := snapshot.GetAllGroups(); err == nil {
+		t.Error("Expected the failure to be shared")
+	}
+	snapshot.GetAllSensors()
+	snapshot.GetCapabilities()
+	if bridge.calls != 1 {
+		t.Errorf("Expected one request to the bridge, got %d", bridge.calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	snapshot.GetAllLights()
+	if bridge.calls != 2 {
+		t.Errorf("Expected the bridge to be retried once the failure is stale, got %d requests", bridge.calls)
+	}
+}
+
+func TestSnapshotBridgeKeepsPolledSnapshotOnFailure(t *testing.T) {
+	stub := test.NewStubBridge().WithLights([]hue.Light{
+		hue.Light{Name: "Hallway"},
+	})
+	snapshot := newSnapshotBridge("test_hue", stub, "test", 0)
+	if _, err := snapshot.snapshot(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stub.WithFailure(test.GetDatastoreFailure)
+	snapshot.refreshMutex.Lock()
+	_, err := snapshot.refresh()
+	snapshot.refreshMutex.Unlock()
+	if err == nil {
+		t.Fatal("Expected the refresh to fail")
+	}
+
+	lights, err := snapshot.GetAllLights()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(lights) != 1 {
+		t.Errorf("Expected the previous snapshot with 1 light, got %d lights", len(lights))
+	}
+}
+
+func TestSnapshotBridgeNotifiesObservers(t *testing.T) {
+	stub := test.NewStubBridge()
+	snapshot := newSnapshotBridge("test_hue", stub, "test", time.Nanosecond)
+	observed := 0
+	snapshot.observe(func(d *datastore.Datastore) {
+		observed++
+	})
+
+	snapshot.GetAllLights()
+	time.Sleep(time.Millisecond)
+	snapshot.GetAllLights()
+	stub.WithFailure(test.GetDatastoreFailure)
+	time.Sleep(time.Millisecond)
+	snapshot.GetAllLights()
+	if observed != 2 {
+		t.Errorf("Expected two snapshots to be observed, got %d", observed)
+	}
+}
+
+// capabilityCountingBridge counts the requests for capabilities made to the bridge it wraps
+type capabilityCountingBridge struct {
+	Bridge
+	calls int
+}
+
+func (b *capabilityCountingBridge) GetCapabilities() (datastore.Capabilities, error) {
+	b.calls++
+	return b.Bridge.GetCapabilities()
+}
+
+func TestSnapshotBridgeServesCapabilities(t *testing.T) {
+	bridge := &capabilityCountingBridge{Bridge: test.NewStubBridge().WithCapabilities(datastore.Capabilities{
+		"lights": {Available: 61, Total: 63},
+	})}
+	snapshot := newSnapshotBridge("test_hue", bridge, "test", 0)
+	snapshot.refresh()
+
+	for i := 0; i < 3; i++ {
+		capabilities, err := snapshot.GetCapabilities()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if capabilities["lights"].Total != 63 {
+			t.Errorf("Expected the capabilities from the snapshot, got %v", capabilities)
+		}
+	}
+	if bridge.calls != 1 {
+		t.Errorf("Expected one request for capabilities, got %d", bridge.calls)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultLightPollInterval is how often the state of lights is polled for the state tracker, unless
+// configured otherwise
+const defaultLightPollInterval = 5 * time.Second
+
+// onState is whether a light or group was on at a point in time
+type onState struct {
+	on   bool
+	time time.Time
+}
+
+// stateTracker follows lights and groups being switched on and off between scrapes, from every snapshot of
+// the bridge and from a more frequent poll of its lights. A group is on while any of its lights is on.
+type stateTracker struct {
+	mutex sync.Mutex
+	// updated is the time of the latest state seen, so that states from before it are ignored
+	updated time.Time
+	lights  map[string]onState
+	groups  map[string]onState
+	// members is the IDs of the lights in each group, by the group's ID
+	members map[string][]string
+	// groupLabels is the labels of each group, by its ID
+	groupLabels map[string]prometheus.Labels
+
+	lightOnSeconds  *prometheus.CounterVec
+	lightChanges    *prometheus.CounterVec
+	lightLastChange *prometheus.GaugeVec
+	groupOnSeconds  *prometheus.CounterVec
+	groupChanges    *prometheus.CounterVec
+	groupLastChange *prometheus.GaugeVec
+}
+
+func newStateTracker(namespace string, bridgeName string) *stateTracker {
+	return &stateTracker{
+		lights:      make(map[string]onState),
+		groups:      make(map[string]onState),
+		members:     make(map[string][]string),
+		groupLabels: make(map[string]prometheus.Labels),
+		lightOnSeconds: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "on_seconds_total",
+				Help:        "Time the light has been on while the exporter has been running",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableLightLabelNames),
+		),
+		lightChanges: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "state_changes_total",
+				Help:        "Count of times the light has been switched on or off",
+				ConstLabels: constLabels(bridgeName),
+			},
+			append(labelNames(variableLightLabelNames), "to"),
+		),
+		lightLastChange: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "light",
+				Name:        "last_change_timestamp_seconds",
+				Help:        "Time the light was last seen to be switched on or off (Unix epoch)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableLightLabelNames),
+		),
+		groupOnSeconds: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "on_seconds_total",
+				Help:        "Time any light in the group has been on while the exporter has been running",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+		groupChanges: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "state_changes_total",
+				Help:        "Count of times the first light in the group has been switched on, or the last switched off",
+				ConstLabels: constLabels(bridgeName),
+			},
+			append(labelNames(variableGroupLabelNames), "to"),
+		),
+		groupLastChange: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Subsystem:   "group",
+				Name:        "last_change_timestamp_seconds",
+				Help:        "Time the group was last seen to be switched on or off (Unix epoch)",
+				ConstLabels: constLabels(bridgeName),
+			},
+			labelNames(variableGroupLabelNames),
+		),
+	}
+}
+
+// observe follows the lights in a snapshot of the bridge, and the groups they are in
+func (s *stateTracker) observe(d *datastore.Datastore) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !d.Fetched.After(s.updated) {
+		return
+	}
+	s.members = make(map[string][]string)
+	s.groupLabels = make(map[string]prometheus.Labels)
+	for _, group := range d.Groups {
+		s.members[d.IDs.Group(group)] = group.Lights
+		s.groupLabels[d.IDs.Group(group)] = labelsForGroup(group, d.IDs)
+	}
+	s.recordLights(d)
+}
+
+// observeLights follows the state of every light in a poll of them
+func (s *stateTracker) observeLights(d *datastore.Datastore) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !d.Fetched.After(s.updated) {
+		return
+	}
+	s.recordLights(d)
+}
+
+// recordLights records the state of every light, and of the groups they are in, from a datastore fetched later
+// than any seen before. Lights that are unreachable are assumed to have been switched off at the wall. The
+// caller must hold mutex.
+func (s *stateTracker) recordLights(d *datastore.Datastore) {
+	at := d.Fetched
+	s.updated = at
+
+	lightsOn := make(map[string]bool)
+	for _, light := range d.Lights {
+		on := light.State.On && light.State.Reachable
+		lightsOn[d.IDs.Light(light)] = on
+		updateOnState(s.lights, light.UniqueID, on, at, labelsForLight(light, d.IDs), s.lightOnSeconds, s.lightChanges, s.lightLastChange)
+	}
+	for id, members := range s.members {
+		on := false
+		for _, member := range members {
+			on = on || lightsOn[member]
+		}
+		updateOnState(s.groups, id, on, at, s.groupLabels[id], s.groupOnSeconds, s.groupChanges, s.groupLastChange)
+	}
+}
+
+// updateOnState records the state of a light or group, counting the time it was on since it was last seen
+// and whether it has changed
+func updateOnState(states map[string]onState, key string, on bool, at time.Time, labels prometheus.Labels, onSeconds *prometheus.CounterVec, changes *prometheus.CounterVec, lastChange *prometheus.GaugeVec) {
+	previous, seen := states[key]
+	states[key] = onState{on: on, time: at}
+	if !seen {
+		return
+	}
+	if previous.on {
+		onSeconds.With(labels).Add(at.Sub(previous.time).Seconds())
+	} else {
+		// Create the series, so that lights that stay off report no time on rather than nothing
+		onSeconds.With(labels)
+	}
+	if on == previous.on {
+		return
+	}
+	to := "off"
+	if on {
+		to = "on"
+	}
+	changeLabels := prometheus.Labels{"to": to}
+	for name, value := range labels {
+		changeLabels[name] = value
+	}
+	changes.With(changeLabels).Inc()
+	lastChange.With(labels).Set(float64(at.Unix()))
+}
+
+func (s *stateTracker) Describe(ch chan<- *prometheus.Desc) {
+	s.lightOnSeconds.Describe(ch)
+	s.lightChanges.Describe(ch)
+	s.lightLastChange.Describe(ch)
+	s.groupOnSeconds.Describe(ch)
+	s.groupChanges.Describe(ch)
+	s.groupLastChange.Describe(ch)
+}
+
+func (s *stateTracker) Collect(ch chan<- prometheus.Metric) {
+	s.lightOnSeconds.Collect(ch)
+	s.lightChanges.Collect(ch)
+	s.lightLastChange.Collect(ch)
+	s.groupOnSeconds.Collect(ch)
+	s.groupChanges.Collect(ch)
+	s.groupLastChange.Collect(ch)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStateTracker(t *testing.T) {
+	tracker := newStateTracker("test_hue", "test")
+	hallway := hue.Light{Index: 1, Name: "Hallway", UniqueID: "00:17:88:01:00:bd:c7:b9-0b"}
+	hallway.State.Reachable = true
+	landing := hue.Light{Index: 2, Name: "Landing", UniqueID: "00:17:88:01:00:bd:c7:ba-0b"}
+	landing.State.Reachable = true
+	upstairs := hue.Group{Index: 1, Name: "Upstairs", Type: "Zone", Lights: []string{"1", "2"}}
+	start := time.Now()
+
+	tracker.observe(&datastore.Datastore{
+		Lights:  []hue.Light{hallway, landing},
+		Groups:  []hue.Group{upstairs},
+		Fetched: start,
+	})
+	hallway.State.On = true
+	tracker.observeLights(&datastore.Datastore{Lights: []hue.Light{hallway, landing}, Fetched: start.Add(10 * time.Second)})
+	landing.State.On = true
+	tracker.observeLights(&datastore.Datastore{Lights: []hue.Light{hallway, landing}, Fetched: start.Add(20 * time.Second)})
+	hallway.State.On = false
+	tracker.observeLights(&datastore.Datastore{Lights: []hue.Light{hallway, landing}, Fetched: start.Add(30 * time.Second)})
+	// A snapshot from before the latest poll is ignored
+	tracker.observe(&datastore.Datastore{
+		Lights:  []hue.Light{landing},
+		Groups:  []hue.Group{upstairs},
+		Fetched: start.Add(25 * time.Second),
+	})
+	landing.State.Reachable = false
+	tracker.observeLights(&datastore.Datastore{Lights: []hue.Light{hallway, landing}, Fetched: start.Add(40 * time.Second)})
+
+	with := func(labels prometheus.Labels, name string, value string) prometheus.Labels {
+		l := prometheus.Labels{name: value}
+		for k, v := range labels {
+			l[k] = v
+		}
+		return l
+	}
+	if actual := counterValue(t, tracker.lightOnSeconds.With(labelsForLight(hallway, datastore.IDs{}))); actual != 20 {
+		t.Errorf("Expected hallway on for 20 seconds, got %v", actual)
+	}
+	if actual := counterValue(t, tracker.lightOnSeconds.With(labelsForLight(landing, datastore.IDs{}))); actual != 20 {
+		t.Errorf("Expected landing on for 20 seconds, got %v", actual)
+	}
+	if actual := counterValue(t, tracker.lightChanges.With(with(labelsForLight(hallway, datastore.IDs{}), "to", "on"))); actual != 1 {
+		t.Errorf("Expected hallway switched on once, got %v", actual)
+	}
+	if actual := gaugeValue(t, tracker.lightLastChange.With(labelsForLight(landing, datastore.IDs{}))); actual != float64(start.Add(40*time.Second).Unix()) {
+		t.Errorf("Expected landing last changed when it became unreachable, got %v", actual)
+	}
+	if actual := counterValue(t, tracker.groupOnSeconds.With(labelsForGroup(upstairs, datastore.IDs{}))); actual != 30 {
+		t.Errorf("Expected upstairs on for 30 seconds, got %v", actual)
+	}
+	if actual := counterValue(t, tracker.groupChanges.With(with(labelsForGroup(upstairs, datastore.IDs{}), "to", "on"))); actual != 1 {
+		t.Errorf("Expected upstairs switched on once, got %v", actual)
+	}
+	if actual := counterValue(t, tracker.groupChanges.With(with(labelsForGroup(upstairs, datastore.IDs{}), "to", "off"))); actual != 1 {
+		t.Errorf("Expected upstairs switched off once, got %v", actual)
+	}
+}
+
+func TestStateTrackerIgnoresStaleSnapshots(t *testing.T) {
+	tracker := newStateTracker("test_hue", "test")
+	start := time.Unix(1536777651, 0)
+	hallway := hue.Light{Index: 1, Name: "Hallway", UniqueID: "1"}
+	hallway.State.On = true
+	hallway.State.Reachable = true
+
+	tracker.observe(&datastore.Datastore{
+		Lights:  []hue.Light{hallway},
+		Groups:  []hue.Group{{Index: 1, Name: "Downstairs", Lights: []string{"1"}}},
+		Fetched: start.Add(10 * time.Second),
+	})
+	tracker.observe(&datastore.Datastore{
+		Lights:  []hue.Light{hallway},
+		Groups:  []hue.Group{{Index: 2, Name: "Upstairs", Lights: []string{"1"}}},
+		Fetched: start,
+	})
+
+	if _, ok := tracker.members["1"]; !ok || len(tracker.members) != 1 {
+		t.Errorf("Expected the groups of the stale snapshot to be ignored, got %v", tracker.members)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// switchActions names the last digit of a Hue dimmer switch's `buttonevent` code, which is its button number
+// * 1000 plus this
+var switchActions = map[uint16]string{
+	0: "initial_press",
+	1: "hold",
+	2: "short_release",
+	3: "long_release",
+}
+
+// tapButtons maps the `buttonevent` codes of the Hue tap switch to its button numbers
+var tapButtons = map[uint16]int{
+	34: 1,
+	16: 2,
+	17: 3,
+	18: 4,
+}
+
+// decodeButtonEvent returns the button number and the action of a switch's `buttonevent` code, if the switch
+// is one that's known and the code is valid for it
+func decodeButtonEvent(sensorType string, code uint16) (int, string, bool) {
+	switch sensorType {
+	case "ZLLSwitch":
+		action, ok := switchActions[code%1000]
+		if !ok || code < 1000 {
+			return 0, "", false
+		}
+		return int(code / 1000), action, true
+	case "ZGPSwitch":
+		// The tap switch only reports presses
+		if button, ok := tapButtons[code]; ok {
+			return button, "press", true
+		}
+	}
+	return 0, "", false
+}
+
+// switchTracker counts the presses of switch buttons seen in every snapshot of the bridge. The bridge only
+// reports the latest event of each switch, so a press is counted when the time it was last updated changes,
+// and presses between snapshots are missed.
+type switchTracker struct {
+	mutex   sync.Mutex
+	updated map[string]time.Time
+
+	presses *prometheus.CounterVec
+}
+
+func newSwitchTracker(namespace string, bridgeName string) *switchTracker {
+	return &switchTracker{
+		updated: make(map[string]time.Time),
+		presses: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "switch",
+				Name:        "presses_total",
+				Help:        "Count of switch button events seen while the exporter has been running",
+				ConstLabels: constLabels(bridgeName),
+			},
+			append(labelNames(variableSensorLabelNames), "button", "action"),
+		),
+	}
+}
+
+// observe counts the switches that have been updated since the previous snapshot
+func (s *switchTracker) observe(d *datastore.Datastore) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, sensor := range d.Sensors {
+		button, action, ok := decodeButtonEvent(sensor.Type, sensor.State.ButtonEvent)
+		if !ok {
+			continue
+		}
+		var lastUpdated time.Time
+		if sensor.State.LastUpdated.Time != nil {
+			lastUpdated = *sensor.State.LastUpdated.Time
+		}
+		previous, seen := s.updated[sensor.UniqueID]
+		s.updated[sensor.UniqueID] = lastUpdated
+		// Switches that have never been used, or that were used before they were first seen, aren't counted
+		if !seen || lastUpdated.IsZero() || !lastUpdated.After(previous) {
+			continue
+		}
+		s.presses.With(labelsForSwitch(sensor, d.IDs, button, action)).Inc()
+	}
+}
+
+func labelsForSwitch(sensor hue.Sensor, ids datastore.IDs, button int, action string) prometheus.Labels {
+	labels := labelsForSensor(sensor, ids)
+	labels["button"] = strconv.Itoa(button)
+	labels["action"] = action
+	return labels
+}
+
+func (s *switchTracker) Describe(ch chan<- *prometheus.Desc) {
+	s.presses.Describe(ch)
+}
+
+func (s *switchTracker) Collect(ch chan<- prometheus.Metric) {
+	s.presses.Collect(ch)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+)
+
+func TestDecodeButtonEvent(t *testing.T) {
+	cases := []struct {
+		sensorType string
+		code       uint16
+		button     int
+		action     string
+		ok         bool
+	}{
+		{"ZLLSwitch", 1002, 1, "short_release", true},
+		{"ZLLSwitch", 4003, 4, "long_release", true},
+		{"ZLLSwitch", 2001, 2, "hold", true},
+		{"ZLLSwitch", 3000, 3, "initial_press", true},
+		{"ZLLSwitch", 1004, 0, "", false},
+		{"ZLLSwitch", 0, 0, "", false},
+		{"ZGPSwitch", 34, 1, "press", true},
+		{"ZGPSwitch", 18, 4, "press", true},
+		{"ZGPSwitch", 0, 0, "", false},
+		{"ZLLPresence", 1002, 0, "", false},
+	}
+	for _, c := range cases {
+		button, action, ok := decodeButtonEvent(c.sensorType, c.code)
+		if button != c.button || action != c.action || ok != c.ok {
+			t.Errorf("Expected %v %d to decode to %d %q %v, got %d %q %v", c.sensorType, c.code, c.button, c.action, c.ok, button, action, ok)
+		}
+	}
+}
+
+func TestSwitchTracker(t *testing.T) {
+	tracker := newSwitchTracker("test_hue", "test")
+	dimmer := hue.Sensor{Name: "Dimmer", Type: "ZLLSwitch", ModelID: "RWL021", UniqueID: "00:17:88:01:10:3e:3f:cc-02-fc00"}
+	start := time.Now().Truncate(time.Second)
+	observe := func(code uint16, updated time.Time) {
+		dimmer.State.ButtonEvent = code
+		dimmer.State.LastUpdated = hue.UpdateTime{Time: &updated}
+		tracker.observe(&datastore.Datastore{Sensors: []hue.Sensor{dimmer}})
+	}
+
+	// The press from before the switch was first seen isn't counted
+	observe(1002, start)
+	observe(1002, start.Add(time.Minute))
+	observe(1002, start.Add(time.Minute))
+	observe(4003, start.Add(2*time.Minute))
+	observe(1002, start.Add(3*time.Minute))
+
+	if actual := counterValue(t, tracker.presses.With(labelsForSwitch(dimmer, datastore.IDs{}, 1, "short_release"))); actual != 2 {
+		t.Errorf("Expected 2 short presses of the on button, got %v", actual)
+	}
+	if actual := counterValue(t, tracker.presses.With(labelsForSwitch(dimmer, datastore.IDs{}, 4, "long_release"))); actual != 1 {
+		t.Errorf("Expected 1 long press of the off button, got %v", actual)
+	}
+}
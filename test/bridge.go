@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	hue "github.com/collinux/gohue"
+	"github.com/mitchellrj/hue_exporter/datastore"
+	"time"
 )
 
 type APIFailure int
@@ -13,13 +15,24 @@ const (
 	GetGroupsFailure
 	GetLightsFailure
 	GetSensorsFailure
+	GetDatastoreFailure
+	GetScenesFailure
+	GetSchedulesFailure
+	GetRulesFailure
+	GetCapabilitiesFailure
 )
 
 type stubHueBridge struct {
-	ctx     context.Context
-	lights  []hue.Light
-	groups  []hue.Group
-	sensors []hue.Sensor
+	ctx          context.Context
+	lights       []hue.Light
+	groups       []hue.Group
+	sensors      []hue.Sensor
+	scenes       []hue.Scene
+	schedules    []datastore.Schedule
+	rules        []datastore.Rule
+	capabilities datastore.Capabilities
+	config       datastore.Config
+	lightUpdates map[string]datastore.SoftwareUpdate
 }
 
 func NewStubBridge() *stubHueBridge {
@@ -48,6 +61,36 @@ func (s *stubHueBridge) WithSensors(sensors []hue.Sensor) *stubHueBridge {
 	return s
 }
 
+func (s *stubHueBridge) WithScenes(scenes []hue.Scene) *stubHueBridge {
+	s.scenes = scenes
+	return s
+}
+
+func (s *stubHueBridge) WithSchedules(schedules []datastore.Schedule) *stubHueBridge {
+	s.schedules = schedules
+	return s
+}
+
+func (s *stubHueBridge) WithRules(rules []datastore.Rule) *stubHueBridge {
+	s.rules = rules
+	return s
+}
+
+func (s *stubHueBridge) WithCapabilities(capabilities datastore.Capabilities) *stubHueBridge {
+	s.capabilities = capabilities
+	return s
+}
+
+func (s *stubHueBridge) WithConfig(config datastore.Config) *stubHueBridge {
+	s.config = config
+	return s
+}
+
+func (s *stubHueBridge) WithLightUpdates(lightUpdates map[string]datastore.SoftwareUpdate) *stubHueBridge {
+	s.lightUpdates = lightUpdates
+	return s
+}
+
 func (s *stubHueBridge) Login(apiKey string) error {
 	if val, ok := s.ctx.Value(LoginFailure).(bool); ok && val {
 		return errors.New("Deliberate login failure")
@@ -75,3 +118,49 @@ func (s *stubHueBridge) GetAllSensors() ([]hue.Sensor, error) {
 	}
 	return s.sensors, nil
 }
+
+func (s *stubHueBridge) GetAllScenes() ([]hue.Scene, error) {
+	if val, ok := s.ctx.Value(GetScenesFailure).(bool); ok && val {
+		return []hue.Scene{}, errors.New("Deliberate get scenes failure")
+	}
+	return s.scenes, nil
+}
+
+func (s *stubHueBridge) GetAllSchedules() ([]datastore.Schedule, error) {
+	if val, ok := s.ctx.Value(GetSchedulesFailure).(bool); ok && val {
+		return []datastore.Schedule{}, errors.New("Deliberate get schedules failure")
+	}
+	return s.schedules, nil
+}
+
+func (s *stubHueBridge) GetAllRules() ([]datastore.Rule, error) {
+	if val, ok := s.ctx.Value(GetRulesFailure).(bool); ok && val {
+		return []datastore.Rule{}, errors.New("Deliberate get rules failure")
+	}
+	return s.rules, nil
+}
+
+func (s *stubHueBridge) GetCapabilities() (datastore.Capabilities, error) {
+	if val, ok := s.ctx.Value(GetCapabilitiesFailure).(bool); ok && val {
+		return nil, errors.New("Deliberate get capabilities failure")
+	}
+	return s.capabilities, nil
+}
+
+func (s *stubHueBridge) GetDatastore() (*datastore.Datastore, error) {
+	if val, ok := s.ctx.Value(GetDatastoreFailure).(bool); ok && val {
+		return nil, errors.New("Deliberate get datastore failure")
+	}
+	return &datastore.Datastore{
+		Lights:    s.lights,
+		Groups:    s.groups,
+		Sensors:   s.sensors,
+		Scenes:    s.scenes,
+		Schedules: s.schedules,
+		Rules:     s.rules,
+		Config:    s.config,
+
+		LightUpdates: s.lightUpdates,
+		Fetched:      time.Now(),
+	}, nil
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// NewCLIPv2Server starts a fake bridge that serves the CLIP v2 API over HTTPS, with a self-signed
+// certificate. It serves the resources in the given document, in the format of a response to
+// `GET /clip/v2/resource`, to clients that present the given application key.
+func NewCLIPv2Server(key string, resources []byte) *httptest.Server {
+	return NewCLIPv2ServerWithEvents(key, resources, nil)
+}
+
+// NewCLIPv2ServerWithEvents starts a fake bridge like NewCLIPv2Server, whose event stream replays a recording
+// of server-sent events from a real bridge to each client that connects, then closes.
+func NewCLIPv2ServerWithEvents(key string, resources []byte, events []byte) *httptest.Server {
+	var all struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(resources, &all); err != nil {
+		panic("invalid CLIP v2 resources: " + err.Error())
+	}
+
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("hue-application-key") != key {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":[{"description":"unauthorized user"}],"data":[]}`))
+			return
+		}
+		if r.URL.Path == "/eventstream/clip/v2" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write(events)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/clip/v2/resource" {
+			w.Write(resources)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/clip/v2/resource/") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"description":"resource not found"}],"data":[]}`))
+			return
+		}
+
+		resourceType := strings.TrimPrefix(r.URL.Path, "/clip/v2/resource/")
+		filtered := []json.RawMessage{}
+		for _, raw := range all.Data {
+			var resource struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(raw, &resource)
+			if resource.Type == resourceType {
+				filtered = append(filtered, raw)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": []interface{}{},
+			"data":   filtered,
+		})
+	}))
+}